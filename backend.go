@@ -0,0 +1,85 @@
+package pidp11
+
+import (
+	"github.com/stianeikeland/go-rpio/v4"
+)
+
+type PinMode int
+
+const (
+	ModeInput PinMode = iota
+	ModeOutput
+)
+
+type PinPull int
+
+const (
+	PullOff PinPull = iota
+	PullUp
+	PullDown
+)
+
+// Low-level access to the GPIO pins of the leds and switches matrix.
+// The pin numbers are the BCM GPIO numbers, as in ledRows, gpioRows and
+// gpioCols.
+type Backend interface {
+	Open() error
+	Close() error
+	Mode(pin uint, mode PinMode)
+	Pull(pin uint, pull PinPull)
+	Write(pin uint, high bool)
+	Read(pin uint) bool // true if the level is high
+}
+
+// Implemented by the backends which can fail while the panel runs, eg
+// when talking to a server: the main loop stops once the channel is
+// closed, Stop() then returning the error from closing the backend.
+type FailingBackend interface {
+	Failed() <-chan struct{}
+}
+
+// The default backend, driving the pins of the rpi via /dev/gpiomem.
+type rpioBackend struct{}
+
+func NewRpioBackend() Backend {
+	return rpioBackend{}
+}
+
+func (rpioBackend) Open() error {
+	return rpio.Open()
+}
+
+func (rpioBackend) Close() error {
+	return rpio.Close()
+}
+
+func (rpioBackend) Mode(pin uint, mode PinMode) {
+	if mode == ModeOutput {
+		rpio.Pin(pin).Output()
+	} else {
+		rpio.Pin(pin).Input()
+	}
+}
+
+func (rpioBackend) Pull(pin uint, pull PinPull) {
+	switch pull {
+	case PullUp:
+		rpio.Pin(pin).PullUp()
+	case PullDown:
+		rpio.Pin(pin).PullDown()
+	default:
+		rpio.Pin(pin).PullOff()
+	}
+}
+
+func (rpioBackend) Write(pin uint, high bool) {
+	if high {
+		rpio.Pin(pin).High()
+	} else {
+		rpio.Pin(pin).Low()
+	}
+}
+
+func (rpioBackend) Read(pin uint) bool {
+	return rpio.Pin(pin).Read() == rpio.High
+}
@@ -0,0 +1,261 @@
+package blinkenlight
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+const (
+	syncInterval = 20 * time.Millisecond // between the polls of the switches
+	// Between the updates of the leds, fast enough for the dithering of
+	// the dimmed leds not to be seen as flickering.
+	ledsInterval = 5 * time.Millisecond
+	knobInterval = 5 * time.Millisecond // between the knob contact changes
+)
+
+// Backend running the panel through a Blinkenlight API server, such as
+// the stock pidp11 server owning the GPIO pins, instead of driving the
+// pins.
+// The matrix is emulated in memory: the brightness of each led is taken
+// from the proportion of refreshes it was lit, and sent to the server as
+// a level if its control has several bits per led, otherwise as on/off
+// values averaging to it. The switches are polled from the server, the
+// changes of the knob positions being turned into knob rotations.
+type Backend struct {
+	addr    string
+	mem     *pidp11.MemBackend
+	client  *Client
+	outputs []ControlInfo
+	inputs  []ControlInfo
+	lit     map[pidp11.LedID]uint64 // counts at the last sync
+	refresh map[pidp11.LedID]uint64
+	dither  map[pidp11.LedID]float64
+	knobs   map[string]int // positions
+	turns   chan knobTurn  // rotations not yet made on the knobs
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	failed  chan struct{} // closed when the synchronisation fails
+	mu      sync.Mutex
+	err     error
+}
+
+// Creates a backend for the server at addr, see Dial().
+func NewBackend(addr string) *Backend {
+	return &Backend{addr: addr}
+}
+
+// Connects to the server and starts synchronising the panel with it.
+func (b *Backend) Open() error {
+	client, err := Dial(b.addr)
+	if err != nil {
+		return err
+	}
+	ctls, err := client.Controls(0)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	b.client = client
+	b.mem = pidp11.NewMemBackend()
+	b.outputs, b.inputs = nil, nil
+	for _, ctl := range ctls {
+		if ctl.Input {
+			b.inputs = append(b.inputs, ctl)
+		} else {
+			b.outputs = append(b.outputs, ctl)
+		}
+	}
+	b.lit = map[pidp11.LedID]uint64{}
+	b.refresh = map[pidp11.LedID]uint64{}
+	b.dither = map[pidp11.LedID]float64{}
+	b.knobs = nil
+	b.err = nil
+	b.turns = make(chan knobTurn, 64)
+	b.stop = make(chan struct{})
+	b.failed = make(chan struct{})
+	b.wg.Add(2)
+	go b.sync()
+	go b.turnKnobs()
+	return nil
+}
+
+// Closed when the synchronisation fails, eg the connection to the server
+// is lost, which stops the panel, see pidp11.FailingBackend.
+func (b *Backend) Failed() <-chan struct{} {
+	return b.failed
+}
+
+// Stops the synchronisation, returning its error if it failed.
+func (b *Backend) Close() error {
+	close(b.stop)
+	b.wg.Wait()
+	b.client.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.err
+}
+
+func (b *Backend) Mode(pin uint, mode pidp11.PinMode) {
+	b.mem.Mode(pin, mode)
+}
+
+func (b *Backend) Pull(pin uint, pull pidp11.PinPull) {
+	b.mem.Pull(pin, pull)
+}
+
+func (b *Backend) Write(pin uint, high bool) {
+	b.mem.Write(pin, high)
+}
+
+func (b *Backend) Read(pin uint) bool {
+	return b.mem.Read(pin)
+}
+
+func (b *Backend) sync() {
+	defer b.wg.Done()
+	ledsTicker := time.NewTicker(ledsInterval)
+	defer ledsTicker.Stop()
+	switchesTicker := time.NewTicker(syncInterval)
+	defer switchesTicker.Stop()
+	for {
+		var err error
+		select {
+		case <-b.stop:
+			// The leds are off once the loop exits
+			b.client.SetOutputs(0, EncodeValues(b.outputs, make([]uint64, len(b.outputs))))
+			return
+		case <-ledsTicker.C:
+			err = b.sendLeds()
+		case <-switchesTicker.C:
+			err = b.pollSwitches()
+		}
+		if err != nil {
+			b.mu.Lock()
+			b.err = fmt.Errorf("blinkenlight: %w", err)
+			b.mu.Unlock()
+			close(b.failed)
+			<-b.stop
+			return
+		}
+	}
+}
+
+func (b *Backend) sendLeds() error {
+	values := make([]uint64, len(b.outputs))
+	for i, out := range b.outputs {
+		ctl, ok := controlByName(out.Name, false)
+		if !ok {
+			continue
+		}
+		bits := max(out.Bits/len(ctl.leds), 1)
+		for n, id := range ctl.leds {
+			values[i] |= b.ledValue(id, bits) << (n * bits)
+		}
+	}
+	return b.client.SetOutputs(0, EncodeValues(b.outputs, values))
+}
+
+// Returns the value of the led for this update: its level on the given
+// bits, or for a single bit its state, the error being carried over so
+// that the states average to the brightness.
+func (b *Backend) ledValue(id pidp11.LedID, bits int) uint64 {
+	lit, refresh := b.mem.LedStats(id)
+	var duty float64
+	if refresh > b.refresh[id] {
+		duty = float64(lit-b.lit[id]) / float64(refresh-b.refresh[id])
+	}
+	b.lit[id], b.refresh[id] = lit, refresh
+	if bits > 1 {
+		return uint64(math.Round(duty * float64(uint64(1)<<bits-1)))
+	}
+	b.dither[id] += duty
+	if b.dither[id] >= .5 {
+		b.dither[id]--
+		return 1
+	}
+	return 0
+}
+
+func (b *Backend) pollSwitches() error {
+	buf, err := b.client.Inputs(0)
+	if err != nil {
+		return err
+	}
+	initial := b.knobs == nil
+	if initial {
+		b.knobs = map[string]int{}
+	}
+	for i, val := range DecodeValues(b.inputs, buf) {
+		name := b.inputs[i].Name
+		switch name {
+		case "ADDR_SELECT":
+			b.turnKnob(pidp11.SS_KNOBA, name, int(val), len(addrSelectLeds), initial)
+			continue
+		case "DATA_SELECT":
+			b.turnKnob(pidp11.SS_KNOBD, name, int(val), len(dataSelectLeds), initial)
+			continue
+		}
+		ctl, ok := controlByName(name, true)
+		if !ok {
+			continue
+		}
+		for bit, id := range ctl.switches {
+			b.mem.SetSwitchByID(id, val>>bit&1 != 0)
+		}
+	}
+	return nil
+}
+
+type knobTurn struct {
+	id pidp11.SwitchID
+	cw bool
+}
+
+// Queues the rotations turning the knob by the shortest way to its new
+// position.
+func (b *Backend) turnKnob(id pidp11.SwitchID, name string, pos, positions int, initial bool) {
+	last := b.knobs[name]
+	b.knobs[name] = pos
+	if initial {
+		return
+	}
+	delta := ((pos-last)%positions + positions) % positions
+	cw := delta <= positions/2
+	if !cw {
+		delta = positions - delta
+	}
+	for range delta {
+		select {
+		case b.turns <- knobTurn{id, cw}:
+		case <-b.stop:
+			return
+		}
+	}
+}
+
+// Makes the queued rotations, which take a few knob intervals each, out
+// of the synchronisation.
+func (b *Backend) turnKnobs() {
+	defer b.wg.Done()
+	for {
+		select {
+		case <-b.stop:
+			return
+		case turn := <-b.turns:
+			b.mem.TurnKnob(turn.id, turn.cw, knobInterval)
+		}
+	}
+}
+
+func controlByName(name string, input bool) (control, bool) {
+	for _, ctl := range controls {
+		if ctl.Name == name && ctl.Input == input {
+			return ctl, true
+		}
+	}
+	return control{}, false
+}
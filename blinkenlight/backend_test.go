@@ -0,0 +1,143 @@
+package blinkenlight
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+// Starts a panel running through the server.
+func startBackend(t *testing.T, addr string, opts ...pidp11.Option) *pidp11.Panel {
+	t.Helper()
+	opts = append([]pidp11.Option{pidp11.WithBackend(NewBackend(addr)), pidp11.WithLogger(discard)}, opts...)
+	panel := pidp11.NewPanel(opts...)
+	if err := panel.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return panel
+}
+
+func TestBackend(t *testing.T) {
+	server, mem, l := startServer(t)
+	panel := startBackend(t, l.Addr().String())
+	defer panel.Stop()
+
+	fx := pidp11.NewSimpleEffect(0, 0)
+	panel.Led(pidp11.LED_RUN, 1, fx)
+	panel.Led(pidp11.LED_A5, 1, fx)
+	eventually(t, "RUN lit on the server", func() bool {
+		return server.Brightness(pidp11.LED_RUN) == 1 && server.Brightness(pidp11.LED_A5) == 1
+	})
+	if server.Brightness(pidp11.LED_PAUSE) != 0 {
+		t.Error("PAUSE lit on the server")
+	}
+
+	sub := panel.Subscribe(pidp11.SubscribeOptions{Kinds: []pidp11.EventKind{pidp11.KindChange}})
+	mem.SetSwitchByID(pidp11.SS_SR0+5, true)
+	select {
+	case evt := <-sub.C:
+		if evt.ID != pidp11.SS_SR0+5 || !evt.On {
+			t.Errorf("event %v", evt)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no event for SR5")
+	}
+	if !panel.SwitchState(pidp11.SS_SR0 + 5) {
+		t.Error("SR5 off")
+	}
+
+	if err := panel.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "leds off on the server", func() bool {
+		return server.Brightness(pidp11.LED_RUN) == 0 && server.Brightness(pidp11.LED_A5) == 0
+	})
+}
+
+func TestBackendDimmedLed(t *testing.T) {
+	server, _, l := startServer(t)
+	panel := startBackend(t, l.Addr().String(), pidp11.WithBrightnessScaler(pidp11.NewLinearBrightnessScaler(0, 1)))
+	defer panel.Stop()
+
+	panel.Led(pidp11.LED_RUN, .5, pidp11.NewSimpleEffect(0, 0))
+	time.Sleep(100 * time.Millisecond)
+	// Sampled every millisecond for half a second
+	var samples, lit, toggles int
+	last := server.Brightness(pidp11.LED_RUN)
+	start := time.Now()
+	for time.Since(start) < 500*time.Millisecond {
+		time.Sleep(time.Millisecond)
+		bright := server.Brightness(pidp11.LED_RUN)
+		if bright != last {
+			toggles++
+		}
+		if bright == 1 {
+			lit++
+		}
+		samples++
+		last = bright
+	}
+	if lit < samples*3/10 || lit > samples*7/10 {
+		t.Errorf("lit in %d samples out of %d", lit, samples)
+	}
+	// Switched on and off at 30Hz at least
+	if toggles < 30 {
+		t.Errorf("toggled %d times in 500ms", toggles)
+	}
+}
+
+func TestBackendKnobs(t *testing.T) {
+	server, mem, l := startServer(t, pidp11.WithKnobSelectors())
+	panel := startBackend(t, l.Addr().String(), pidp11.WithKnobSelectors())
+	defer panel.Stop()
+
+	for range 3 {
+		mem.TurnKnob(pidp11.SS_KNOBA, true, 5*time.Millisecond)
+	}
+	mem.TurnKnob(pidp11.SS_KNOBD, false, 5*time.Millisecond)
+	eventually(t, "knobs turned on the server", func() bool {
+		return server.AddressSelection() == pidp11.LED_SUPER_D && server.DataSelection() == pidp11.LED_BUS_REG
+	})
+	eventually(t, "knobs turned", func() bool {
+		return panel.AddressSelection() == pidp11.LED_SUPER_D && panel.DataSelection() == pidp11.LED_BUS_REG
+	})
+}
+
+func TestBackendDroppedConnection(t *testing.T) {
+	_, _, l := startServer(t)
+	panel := startBackend(t, l.Addr().String())
+	defer panel.Stop()
+	events := panel.Events()
+
+	l.drop()
+	deadline := time.After(time.Second)
+	for stopped := false; !stopped; {
+		select {
+		case _, ok := <-events:
+			stopped = !ok
+		case <-deadline:
+			t.Fatal("panel still running")
+		}
+	}
+	if err := panel.Stop(); err == nil || !strings.HasPrefix(err.Error(), "blinkenlight:") {
+		t.Errorf("stopped with error %v", err)
+	}
+}
+
+func TestBackendNoServer(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	panel := pidp11.NewPanel(pidp11.WithBackend(NewBackend(addr)), pidp11.WithLogger(discard))
+	if err := panel.Start(context.Background()); err == nil {
+		panel.Stop()
+		t.Fatal("started without a server")
+	}
+}
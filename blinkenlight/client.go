@@ -0,0 +1,236 @@
+// Package blinkenlight implements the Blinkenlight API of Joerg Hoppe,
+// used by the REALCONS consoles of SimH to drive the panels over ONC RPC.
+//
+// The server shows the output controls on the leds of a pidp11.Panel and
+// reads the input controls from its switches, see the controls table for
+// the mapping. The client talks to any Blinkenlight API server, such as
+// the stock pidp11 server, and Backend runs a panel through it.
+//
+// The values of the controls of a panel are exchanged as lists of bytes,
+// each control taking its number of bytes, little-endian, in the order of
+// the control indexes, with only the output controls when setting and
+// the input ones when getting.
+package blinkenlight
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RPC program and version of the Blinkenlight API
+const (
+	Program = 99
+	Version = 1
+)
+
+const (
+	procNull             = 0
+	procGetInfo          = 1
+	procGetPanelInfo     = 2
+	procGetControlInfo   = 3
+	procSetControlValues = 4
+	procGetControlValues = 5
+	procParamGet         = 100
+	procParamSet         = 101
+)
+
+type PanelInfo struct {
+	Name             string
+	InputControls    int
+	OutputControls   int
+	InputValuesSize  int // size of the values list of the input controls
+	OutputValuesSize int
+}
+
+// Time allowed for a call, after which the connection is deemed lost.
+const callTimeout = 5 * time.Second
+
+type Client struct {
+	mu   sync.Mutex
+	conn net.Conn
+	xid  uint32
+}
+
+// Connects to the server at host:port, or at the port registered with
+// the portmapper of the host if no port is given.
+func Dial(addr string) (*Client, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		port, err := callPortmapper(addr, pmapGetPort, 0)
+		if err != nil {
+			return nil, fmt.Errorf("portmapper: %w", err)
+		}
+		if port == 0 {
+			return nil, fmt.Errorf("no blinkenlight server registered on %s", addr)
+		}
+		addr = net.JoinHostPort(addr, strconv.Itoa(int(port)))
+	}
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) call(proc uint32, args func(*xdrWriter)) (*xdrReader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.xid++
+	c.conn.SetDeadline(time.Now().Add(callTimeout))
+	return call(c.conn, c.xid, Program, Version, proc, args)
+}
+
+// Checks the error code of a result.
+func checkResult(r *xdrReader, what string) error {
+	code := r.int32()
+	if r.err != nil {
+		return fmt.Errorf("%s: %w", what, r.err)
+	}
+	if code != 0 {
+		return fmt.Errorf("%s: error code %d", what, code)
+	}
+	return nil
+}
+
+// Returns the description of the server.
+func (c *Client) Info() (string, error) {
+	r, err := c.call(procGetInfo, nil)
+	if err != nil {
+		return "", err
+	}
+	if err := checkResult(r, "getinfo"); err != nil {
+		return "", err
+	}
+	info := r.string()
+	return info, r.err
+}
+
+func (c *Client) PanelInfo(panel int) (PanelInfo, error) {
+	r, err := c.call(procGetPanelInfo, func(w *xdrWriter) {
+		w.uint32(uint32(panel))
+	})
+	if err != nil {
+		return PanelInfo{}, err
+	}
+	if err := checkResult(r, "getpanelinfo"); err != nil {
+		return PanelInfo{}, err
+	}
+	info := PanelInfo{
+		Name:             r.string(),
+		InputControls:    int(r.uint32()),
+		OutputControls:   int(r.uint32()),
+		InputValuesSize:  int(r.uint32()),
+		OutputValuesSize: int(r.uint32()),
+	}
+	return info, r.err
+}
+
+func (c *Client) ControlInfo(panel, control int) (ControlInfo, error) {
+	r, err := c.call(procGetControlInfo, func(w *xdrWriter) {
+		w.uint32(uint32(panel))
+		w.uint32(uint32(control))
+	})
+	if err != nil {
+		return ControlInfo{}, err
+	}
+	if err := checkResult(r, "getcontrolinfo"); err != nil {
+		return ControlInfo{}, err
+	}
+	info := ControlInfo{
+		Name:  r.string(),
+		Input: r.uint32() != 0,
+		Type:  int(r.uint32()),
+		Radix: int(r.uint32()),
+		Bits:  int(r.uint32()),
+		Bytes: int(r.uint32()),
+	}
+	return info, r.err
+}
+
+// Returns the information of all the controls of the panel, in the order
+// of their indexes.
+func (c *Client) Controls(panel int) ([]ControlInfo, error) {
+	info, err := c.PanelInfo(panel)
+	if err != nil {
+		return nil, err
+	}
+	ctls := make([]ControlInfo, info.InputControls+info.OutputControls)
+	for i := range ctls {
+		if ctls[i], err = c.ControlInfo(panel, i); err != nil {
+			return nil, err
+		}
+	}
+	return ctls, nil
+}
+
+// Sets the values of the output controls, see EncodeValues().
+func (c *Client) SetOutputs(panel int, values []byte) error {
+	r, err := c.call(procSetControlValues, func(w *xdrWriter) {
+		w.uint32(uint32(panel))
+		w.opaque(values)
+	})
+	if err != nil {
+		return err
+	}
+	return checkResult(r, "setpanel_controlvalues")
+}
+
+// Returns the values of the input controls, see DecodeValues().
+func (c *Client) Inputs(panel int) ([]byte, error) {
+	r, err := c.call(procGetControlValues, func(w *xdrWriter) {
+		w.uint32(uint32(panel))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := checkResult(r, "getpanel_controlvalues"); err != nil {
+		return nil, err
+	}
+	values := r.opaque()
+	return values, r.err
+}
+
+// Calls the null procedure, checking the server is responsive.
+func (c *Client) Ping() error {
+	_, err := c.call(procNull, nil)
+	return err
+}
+
+// Returns the value of a parameter of an object of the server.
+func (c *Client) Param(class, object, param int) (uint32, error) {
+	return c.param(procParamGet, class, object, param, 0)
+}
+
+// Sets the value of a parameter of an object of the server.
+func (c *Client) SetParam(class, object, param int, value uint32) error {
+	_, err := c.param(procParamSet, class, object, param, value)
+	return err
+}
+
+func (c *Client) param(proc uint32, class, object, param int, value uint32) (uint32, error) {
+	r, err := c.call(proc, func(w *xdrWriter) {
+		w.uint32(uint32(class))
+		w.uint32(uint32(object))
+		w.uint32(uint32(param))
+		if proc == procParamSet {
+			w.uint32(value)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := checkResult(r, "param"); err != nil {
+		return 0, err
+	}
+	for range 3 {
+		r.uint32()
+	}
+	value = r.uint32()
+	return value, r.err
+}
@@ -0,0 +1,161 @@
+package blinkenlight
+
+import "github.com/perpen/pidp11"
+
+// The name of the single panel, as given to REALCONS with
+// "set realcons panel=11/70".
+const PanelName = "11/70"
+
+// Types of controls
+const (
+	TypeSwitch = 1
+	TypeLamp   = 2
+)
+
+// A control of the panel, made of one or more switches or lamps, its
+// value having a bit per switch or lamp.
+type ControlInfo struct {
+	Name  string
+	Input bool
+	Type  int
+	Radix int
+	Bits  int
+	Bytes int // size of the value in the values lists
+}
+
+type control struct {
+	ControlInfo
+	leds     []pidp11.LedID    // outputs, for each bit of the value
+	switches []pidp11.SwitchID // inputs, for each bit of the value
+	// Inputs not mapped to switches
+	read func(s *Server) uint64
+}
+
+// Positions of the knobs, as values of ADDR_SELECT and DATA_SELECT and
+// bits of their feedback lamps. They are in clockwise order, as for
+// pidp11.WithKnobSelectors(), so that a change of value is a rotation.
+var (
+	addrSelectLeds = []pidp11.LedID{
+		pidp11.LED_USER_D, pidp11.LED_USER_I, pidp11.LED_SUPER_I, pidp11.LED_KERNEL_I,
+		pidp11.LED_PROG_PHY, pidp11.LED_CONS_PHY, pidp11.LED_KERNEL_D, pidp11.LED_SUPER_D,
+	}
+	dataSelectLeds = []pidp11.LedID{
+		pidp11.LED_DATA_PATHS, pidp11.LED_μADR_FPP_CPU, pidp11.LED_DISPLAY_REGISTER, pidp11.LED_BUS_REG,
+	}
+)
+
+// The controls of the 11/70 panel, in the order of their indexes.
+var controls = []control{
+	switchesControl("SR", 8, pidp11.SS_SR0, 22),
+	switchesControl("LOAD_ADRS", 2, pidp11.SS_LOAD, 1),
+	switchesControl("EXAM", 2, pidp11.SS_EXAM, 1),
+	switchesControl("DEPOSIT", 2, pidp11.SS_DEP, 1),
+	switchesControl("CONT", 2, pidp11.SS_CONT, 1),
+	switchesControl("HALT", 2, pidp11.SS_HALT, 1),
+	switchesControl("S_BUS_CYCLE", 2, pidp11.SS_S_BUS_CYCLE, 1),
+	switchesControl("START", 2, pidp11.SS_START, 1),
+	switchesControl("LAMPTEST", 2, pidp11.SS_TEST, 1),
+	readControl("ADDR_SELECT", 3, func(s *Server) uint64 {
+		return uint64(index(addrSelectLeds, s.panel.AddressSelection()))
+	}),
+	readControl("DATA_SELECT", 2, func(s *Server) uint64 {
+		return uint64(index(dataSelectLeds, s.panel.DataSelection()))
+	}),
+	readControl("PANEL_LOCK", 1, func(*Server) uint64 { return 0 }),
+	readControl("POWER", 1, func(*Server) uint64 { return 1 }),
+	ledsControl("ADDRESS", 8, pidp11.LED_A0, 22),
+	ledsControl("DATA", 8, pidp11.LED_D0, 16),
+	ledsControl("PARITY_HIGH", 2, pidp11.LED_PAR_HI, 1),
+	ledsControl("PARITY_LOW", 2, pidp11.LED_PAR_LO, 1),
+	ledsControl("PAR_ERR", 2, pidp11.LED_PAR_ERR, 1),
+	ledsControl("ADRS_ERR", 2, pidp11.LED_ADRS_ERR, 1),
+	ledsControl("RUN", 2, pidp11.LED_RUN, 1),
+	ledsControl("PAUSE", 2, pidp11.LED_PAUSE, 1),
+	ledsControl("MASTER", 2, pidp11.LED_MASTER, 1),
+	ledsControl("USER", 2, pidp11.LED_USER, 1),
+	ledsControl("SUPER", 2, pidp11.LED_SUPER, 1),
+	ledsControl("KERNEL", 2, pidp11.LED_KERNEL, 1),
+	ledsControl("DATA_SPACE", 2, pidp11.LED_DATA, 1),
+	ledsControl("ADDRESSING_16", 2, pidp11.LED_ADDR_16, 1),
+	ledsControl("ADDRESSING_18", 2, pidp11.LED_ADDR_18, 1),
+	ledsControl("ADDRESSING_22", 2, pidp11.LED_ADDR_22, 1),
+	{
+		ControlInfo: info("ADDR_SELECT_FEEDBACK", false, 2, len(addrSelectLeds)),
+		leds:        addrSelectLeds,
+	},
+	{
+		ControlInfo: info("DATA_SELECT_FEEDBACK", false, 2, len(dataSelectLeds)),
+		leds:        dataSelectLeds,
+	},
+}
+
+func info(name string, input bool, radix, bits int) ControlInfo {
+	typ := TypeLamp
+	if input {
+		typ = TypeSwitch
+	}
+	return ControlInfo{
+		Name:  name,
+		Input: input,
+		Type:  typ,
+		Radix: radix,
+		Bits:  bits,
+		Bytes: (bits + 7) / 8,
+	}
+}
+
+func switchesControl(name string, radix int, first pidp11.SwitchID, count int) control {
+	ctl := control{ControlInfo: info(name, true, radix, count)}
+	for i := range count {
+		ctl.switches = append(ctl.switches, first+pidp11.SwitchID(i))
+	}
+	return ctl
+}
+
+func readControl(name string, bits int, read func(*Server) uint64) control {
+	return control{ControlInfo: info(name, true, 10, bits), read: read}
+}
+
+func ledsControl(name string, radix int, first pidp11.LedID, count int) control {
+	ctl := control{ControlInfo: info(name, false, radix, count)}
+	for i := range count {
+		ctl.leds = append(ctl.leds, first+pidp11.LedID(i))
+	}
+	return ctl
+}
+
+func index[T comparable](items []T, item T) int {
+	for i, it := range items {
+		if it == item {
+			return i
+		}
+	}
+	return 0
+}
+
+// Encodes the values of the controls, little-endian on the number of
+// bytes of each control.
+func EncodeValues(infos []ControlInfo, values []uint64) []byte {
+	var buf []byte
+	for i, info := range infos {
+		for b := range info.Bytes {
+			buf = append(buf, byte(values[i]>>(8*b)))
+		}
+	}
+	return buf
+}
+
+// Decodes the values of the controls, the missing ones being zero.
+func DecodeValues(infos []ControlInfo, buf []byte) []uint64 {
+	values := make([]uint64, len(infos))
+	for i, info := range infos {
+		for b := range info.Bytes {
+			if len(buf) == 0 {
+				return values
+			}
+			values[i] |= uint64(buf[0]) << (8 * b)
+			buf = buf[1:]
+		}
+	}
+	return values
+}
@@ -0,0 +1,197 @@
+package blinkenlight
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// ONC RPC, RFC 5531, over TCP with record marking.
+
+const (
+	rpcVersion = 2
+	msgCall    = 0
+	msgReply   = 1
+
+	replyAccepted = 0
+	replyDenied   = 1
+
+	acceptSuccess      = 0
+	acceptProgUnavail  = 1
+	acceptProgMismatch = 2
+	acceptProcUnavail  = 3
+	acceptGarbageArgs  = 4
+
+	rejectRPCMismatch = 0
+
+	authNone = 0
+
+	lastFragment = 1 << 31
+	maxRecord    = 1 << 20
+)
+
+// Portmapper, RFC 1833
+const (
+	pmapProgram  = 100000
+	pmapVersion  = 2
+	pmapSet      = 1
+	pmapUnset    = 2
+	pmapGetPort  = 3
+	pmapPort     = 111
+	protoTCP     = 6
+	pmapDeadline = 5 * time.Second
+)
+
+// Reads a record, made of one or more fragments.
+func readRecord(r io.Reader) ([]byte, error) {
+	var rec []byte
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		h := binary.BigEndian.Uint32(header[:])
+		n := int(h &^ lastFragment)
+		if len(rec)+n > maxRecord {
+			return nil, fmt.Errorf("rpc: record too large: %d", len(rec)+n)
+		}
+		start := len(rec)
+		rec = append(rec, make([]byte, n)...)
+		if _, err := io.ReadFull(r, rec[start:]); err != nil {
+			return nil, err
+		}
+		if h&lastFragment != 0 {
+			return rec, nil
+		}
+	}
+}
+
+// Writes a record as a single fragment.
+func writeRecord(w io.Writer, rec []byte) error {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(len(rec))|lastFragment)
+	_, err := w.Write(append(buf, rec...))
+	return err
+}
+
+type rpcCall struct {
+	xid, rpcvers, prog, vers, proc uint32
+	args                           *xdrReader
+}
+
+func parseCall(rec []byte) (rpcCall, error) {
+	r := &xdrReader{buf: rec}
+	var c rpcCall
+	c.xid = r.uint32()
+	if r.uint32() != msgCall {
+		return c, errors.New("rpc: not a call")
+	}
+	c.rpcvers = r.uint32()
+	c.prog = r.uint32()
+	c.vers = r.uint32()
+	c.proc = r.uint32()
+	r.uint32() // credentials
+	r.opaque()
+	r.uint32() // verifier
+	r.opaque()
+	c.args = r
+	return c, r.err
+}
+
+func writeCallHeader(w *xdrWriter, xid, prog, vers, proc uint32) {
+	w.uint32(xid)
+	w.uint32(msgCall)
+	w.uint32(rpcVersion)
+	w.uint32(prog)
+	w.uint32(vers)
+	w.uint32(proc)
+	w.uint32(authNone)
+	w.opaque(nil)
+	w.uint32(authNone)
+	w.opaque(nil)
+}
+
+// Writes the header of an accepted reply, followed by the results if
+// successful.
+func writeReplyHeader(w *xdrWriter, xid, acceptStat uint32) {
+	w.uint32(xid)
+	w.uint32(msgReply)
+	w.uint32(replyAccepted)
+	w.uint32(authNone)
+	w.opaque(nil)
+	w.uint32(acceptStat)
+}
+
+// Parses a reply, returning the reader positioned on the results.
+func parseReply(rec []byte, xid uint32) (*xdrReader, error) {
+	r := &xdrReader{buf: rec}
+	if r.uint32() != xid || r.uint32() != msgReply {
+		return nil, errors.New("rpc: unexpected reply")
+	}
+	if r.uint32() != replyAccepted {
+		return nil, errors.New("rpc: call denied")
+	}
+	r.uint32() // verifier
+	r.opaque()
+	if stat := r.uint32(); stat != acceptSuccess {
+		return nil, fmt.Errorf("rpc: call failed with status %d", stat)
+	}
+	return r, r.err
+}
+
+// Makes a call on the connection, returning the reader of the results.
+func call(conn net.Conn, xid, prog, vers, proc uint32, args func(*xdrWriter)) (*xdrReader, error) {
+	w := &xdrWriter{}
+	writeCallHeader(w, xid, prog, vers, proc)
+	if args != nil {
+		args(w)
+	}
+	if err := writeRecord(conn, w.buf); err != nil {
+		return nil, err
+	}
+	rec, err := readRecord(conn)
+	if err != nil {
+		return nil, err
+	}
+	return parseReply(rec, xid)
+}
+
+// Calls the portmapper of the host.
+func callPortmapper(host string, proc uint32, port int) (uint32, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, fmt.Sprint(pmapPort)), pmapDeadline)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(pmapDeadline))
+	r, err := call(conn, 1, pmapProgram, pmapVersion, proc, func(w *xdrWriter) {
+		w.uint32(Program)
+		w.uint32(Version)
+		w.uint32(protoTCP)
+		w.uint32(uint32(port))
+	})
+	if err != nil {
+		return 0, err
+	}
+	res := r.uint32()
+	return res, r.err
+}
+
+// Registers the server port with the local portmapper, as clients find
+// the server through it.
+func Register(port int) error {
+	Unregister()
+	ok, err := callPortmapper("localhost", pmapSet, port)
+	if err == nil && ok == 0 {
+		err = errors.New("portmapper refused the registration")
+	}
+	return err
+}
+
+// Removes the registration with the local portmapper.
+func Unregister() error {
+	_, err := callPortmapper("localhost", pmapUnset, 0)
+	return err
+}
@@ -0,0 +1,280 @@
+package blinkenlight
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/perpen/pidp11"
+)
+
+// Serves the panel to the Blinkenlight API clients, eg the SimH REALCONS
+// console: the values of the output controls are shown on the leds, and
+// the input controls are read from the switches.
+type Server struct {
+	panel   *pidp11.Panel
+	logger  *slog.Logger
+	fx      pidp11.Effect
+	mu      sync.Mutex
+	outputs map[int]uint64 // last value of each output control
+	pressed map[pidp11.SwitchID]bool
+	params  map[[3]uint32]uint32
+}
+
+func NewServer(panel *pidp11.Panel, logger *slog.Logger) *Server {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Server{
+		panel:   panel,
+		logger:  logger,
+		fx:      pidp11.NewSimpleEffect(0, 0),
+		outputs: map[int]uint64{},
+		pressed: map[pidp11.SwitchID]bool{},
+		params:  map[[3]uint32]uint32{},
+	}
+}
+
+// Accepts connections until the context is done or the listener fails.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	// Presses of the momentary switches are remembered until the next
+	// poll, in case they are shorter than the polling interval.
+	sub := s.panel.Subscribe(pidp11.SubscribeOptions{
+		IDs: []pidp11.SwitchID{
+			pidp11.SS_LOAD, pidp11.SS_EXAM, pidp11.SS_DEP,
+			pidp11.SS_CONT, pidp11.SS_START,
+		},
+		Kinds: []pidp11.EventKind{pidp11.KindChange},
+	})
+	defer sub.Close()
+	go func() {
+		for evt := range sub.C {
+			if evt.On {
+				s.mu.Lock()
+				s.pressed[evt.ID] = true
+				s.mu.Unlock()
+			}
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		s.logger.Info("blinkenlight client connected", "addr", conn.RemoteAddr())
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		rec, err := readRecord(conn)
+		if err != nil {
+			s.logger.Info("blinkenlight client disconnected", "addr", conn.RemoteAddr(), "err", err)
+			return
+		}
+		c, err := parseCall(rec)
+		if err != nil {
+			s.logger.Warn("invalid call", "err", err)
+			return
+		}
+		if err := writeRecord(conn, s.dispatch(c)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) dispatch(c rpcCall) []byte {
+	w := &xdrWriter{}
+	if c.rpcvers != rpcVersion {
+		w.uint32(c.xid)
+		w.uint32(msgReply)
+		w.uint32(replyDenied)
+		w.uint32(rejectRPCMismatch)
+		w.uint32(rpcVersion)
+		w.uint32(rpcVersion)
+		return w.buf
+	}
+	if c.prog != Program {
+		writeReplyHeader(w, c.xid, acceptProgUnavail)
+		return w.buf
+	}
+	if c.vers != Version {
+		writeReplyHeader(w, c.xid, acceptProgMismatch)
+		w.uint32(Version)
+		w.uint32(Version)
+		return w.buf
+	}
+	res := &xdrWriter{}
+	switch c.proc {
+	case procNull:
+	case procGetInfo:
+		res.int32(0)
+		res.string("pidp11 Go driver")
+	case procGetPanelInfo:
+		s.getPanelInfo(c.args, res)
+	case procGetControlInfo:
+		s.getControlInfo(c.args, res)
+	case procSetControlValues:
+		s.setControlValues(c.args, res)
+	case procGetControlValues:
+		s.getControlValues(c.args, res)
+	case procParamGet, procParamSet:
+		s.param(c.proc == procParamSet, c.args, res)
+	default:
+		writeReplyHeader(w, c.xid, acceptProcUnavail)
+		return w.buf
+	}
+	if c.args.err != nil {
+		writeReplyHeader(w, c.xid, acceptGarbageArgs)
+		return w.buf
+	}
+	writeReplyHeader(w, c.xid, acceptSuccess)
+	return append(w.buf, res.buf...)
+}
+
+func (s *Server) getPanelInfo(args *xdrReader, res *xdrWriter) {
+	if args.uint32() != 0 {
+		res.int32(1)
+		res.string("")
+		for range 4 {
+			res.uint32(0)
+		}
+		return
+	}
+	var ins, outs, inBytes, outBytes int
+	for _, ctl := range controls {
+		if ctl.Input {
+			ins++
+			inBytes += ctl.Bytes
+		} else {
+			outs++
+			outBytes += ctl.Bytes
+		}
+	}
+	res.int32(0)
+	res.string(PanelName)
+	res.uint32(uint32(ins))
+	res.uint32(uint32(outs))
+	res.uint32(uint32(inBytes))
+	res.uint32(uint32(outBytes))
+}
+
+func (s *Server) getControlInfo(args *xdrReader, res *xdrWriter) {
+	panel, i := args.uint32(), int(args.uint32())
+	if panel != 0 || i >= len(controls) {
+		writeControlInfo(res, 1, ControlInfo{})
+		return
+	}
+	writeControlInfo(res, 0, controls[i].ControlInfo)
+}
+
+func writeControlInfo(res *xdrWriter, errorCode int32, info ControlInfo) {
+	res.int32(errorCode)
+	res.string(info.Name)
+	isInput := uint32(0)
+	if info.Input {
+		isInput = 1
+	}
+	res.uint32(isInput)
+	res.uint32(uint32(info.Type))
+	res.uint32(uint32(info.Radix))
+	res.uint32(uint32(info.Bits))
+	res.uint32(uint32(info.Bytes))
+}
+
+// Shows the values of the output controls, only changing the leds of the
+// controls whose value changed.
+func (s *Server) setControlValues(args *xdrReader, res *xdrWriter) {
+	panel := args.uint32()
+	buf := args.opaque()
+	if panel != 0 {
+		res.int32(1)
+		return
+	}
+	outputs := filterControls(false)
+	values := DecodeValues(infos(outputs), buf)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	frame := pidp11.NewFrame()
+	for i, ctl := range outputs {
+		if last, ok := s.outputs[i]; ok && last == values[i] {
+			continue
+		}
+		s.outputs[i] = values[i]
+		for bit, id := range ctl.leds {
+			frame.Led(id, float64(values[i]>>bit&1), s.fx)
+		}
+	}
+	s.panel.Commit(frame)
+	res.int32(0)
+}
+
+func (s *Server) getControlValues(args *xdrReader, res *xdrWriter) {
+	if args.uint32() != 0 {
+		res.int32(1)
+		res.opaque(nil)
+		return
+	}
+	inputs := filterControls(true)
+	values := make([]uint64, len(inputs))
+	s.mu.Lock()
+	for i, ctl := range inputs {
+		if ctl.read != nil {
+			values[i] = ctl.read(s)
+			continue
+		}
+		for bit, id := range ctl.switches {
+			if s.panel.SwitchState(id) || s.pressed[id] {
+				values[i] |= 1 << bit
+			}
+			delete(s.pressed, id)
+		}
+	}
+	s.mu.Unlock()
+	res.int32(0)
+	res.opaque(EncodeValues(infos(inputs), values))
+}
+
+// The parameters are recorded but have no effect.
+func (s *Server) param(set bool, args *xdrReader, res *xdrWriter) {
+	key := [3]uint32{args.uint32(), args.uint32(), args.uint32()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if set {
+		s.params[key] = args.uint32()
+	}
+	res.int32(0)
+	for _, v := range key {
+		res.uint32(v)
+	}
+	res.uint32(s.params[key])
+}
+
+func filterControls(input bool) []control {
+	var ctls []control
+	for _, ctl := range controls {
+		if ctl.Input == input {
+			ctls = append(ctls, ctl)
+		}
+	}
+	return ctls
+}
+
+func infos(ctls []control) []ControlInfo {
+	infos := make([]ControlInfo, len(ctls))
+	for i, ctl := range ctls {
+		infos[i] = ctl.ControlInfo
+	}
+	return infos
+}
@@ -0,0 +1,248 @@
+package blinkenlight
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+var discard = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// Listener keeping the accepted connections, so that they can be dropped.
+type listener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *listener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+func (l *listener) drop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		conn.Close()
+	}
+}
+
+// Starts a panel on the in-memory backend, and a server for it.
+func startServer(t *testing.T, opts ...pidp11.Option) (*pidp11.Panel, *pidp11.MemBackend, *listener) {
+	t.Helper()
+	mem := pidp11.NewMemBackend()
+	opts = append([]pidp11.Option{pidp11.WithBackend(mem), pidp11.WithLogger(discard)}, opts...)
+	panel := pidp11.NewPanel(opts...)
+	if err := panel.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { panel.Stop() })
+	tl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &listener{Listener: tl}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewServer(panel, discard).Serve(ctx, l)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return panel, mem, l
+}
+
+func dial(t *testing.T, addr string) *Client {
+	t.Helper()
+	client, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// Fails unless the condition becomes true within a second.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Returns the value of the named control in the values of the controls.
+func value(t *testing.T, infos []ControlInfo, values []uint64, name string) uint64 {
+	t.Helper()
+	for i, info := range infos {
+		if info.Name == name {
+			return values[i]
+		}
+	}
+	t.Fatalf("no control %s", name)
+	return 0
+}
+
+func TestLoopback(t *testing.T) {
+	panel, mem, l := startServer(t)
+	client := dial(t, l.Addr().String())
+
+	if err := client.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := client.Info(); err != nil || info == "" {
+		t.Fatalf("info %q, err %v", info, err)
+	}
+	info, err := client.PanelInfo(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctls, err := client.Controls(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ins, outs []ControlInfo
+	for _, ctl := range ctls {
+		if ctl.Input {
+			ins = append(ins, ctl)
+		} else {
+			outs = append(outs, ctl)
+		}
+	}
+	if info.Name != PanelName || info.InputControls != len(ins) || info.OutputControls != len(outs) {
+		t.Errorf("panel info %+v, with %d inputs and %d outputs", info, len(ins), len(outs))
+	}
+	for i, ctl := range controls {
+		if ctls[i] != ctl.ControlInfo {
+			t.Errorf("control %d: %+v, want %+v", i, ctls[i], ctl.ControlInfo)
+		}
+	}
+	if _, err := client.PanelInfo(1); err == nil {
+		t.Error("no error for panel 1")
+	}
+	if _, err := client.ControlInfo(0, len(controls)); err == nil {
+		t.Error("no error for a control out of range")
+	}
+
+	// Outputs
+	values := make([]uint64, len(outs))
+	for i, ctl := range outs {
+		switch ctl.Name {
+		case "ADDRESS":
+			values[i] = 0o1234
+		case "RUN":
+			values[i] = 1
+		}
+	}
+	if err := client.SetOutputs(0, EncodeValues(outs, values)); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "RUN lit", func() bool { return panel.Brightness(pidp11.LED_RUN) == 1 })
+	for bit := range 22 {
+		want := float64(uint64(0o1234) >> bit & 1)
+		if got := panel.Brightness(pidp11.LED_A0 + pidp11.LedID(bit)); got != want {
+			t.Errorf("A%d: brightness %v, want %v", bit, got, want)
+		}
+	}
+	if panel.Brightness(pidp11.LED_PAUSE) != 0 {
+		t.Error("PAUSE lit")
+	}
+
+	// Inputs
+	mem.SetSwitchByID(pidp11.SS_SR0+3, true)
+	mem.SetSwitchByID(pidp11.SS_HALT, true)
+	eventually(t, "HALT read", func() bool { return panel.SwitchState(pidp11.SS_HALT) })
+	eventually(t, "SR3 read", func() bool { return panel.SwitchState(pidp11.SS_SR0 + 3) })
+	mem.SetSwitchByID(pidp11.SS_START, true)
+	eventually(t, "START read", func() bool { return panel.SwitchState(pidp11.SS_START) })
+	mem.SetSwitchByID(pidp11.SS_START, false)
+	eventually(t, "START released", func() bool { return !panel.SwitchState(pidp11.SS_START) })
+	inputs := func() []uint64 {
+		t.Helper()
+		buf, err := client.Inputs(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return DecodeValues(ins, buf)
+	}
+	in := inputs()
+	for name, want := range map[string]uint64{"SR": 0o10, "HALT": 1, "START": 1, "CONT": 0, "POWER": 1} {
+		if got := value(t, ins, in, name); got != want {
+			t.Errorf("%s = %o, want %o", name, got, want)
+		}
+	}
+	// The press of START is only reported once
+	if got := value(t, ins, inputs(), "START"); got != 0 {
+		t.Errorf("START = %d after the first poll", got)
+	}
+
+	// Parameters
+	if err := client.SetParam(1, 2, 3, 42); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := client.Param(1, 2, 3); err != nil || v != 42 {
+		t.Errorf("param %d, err %v", v, err)
+	}
+	if v, err := client.Param(1, 2, 4); err != nil || v != 0 {
+		t.Errorf("unset param %d, err %v", v, err)
+	}
+}
+
+func TestXDRRoundTrip(t *testing.T) {
+	w := &xdrWriter{}
+	w.uint32(0xdeadbeef)
+	w.int32(-2)
+	w.string("11/70")
+	w.opaque([]byte{1, 2, 3, 4, 5})
+	if len(w.buf)%4 != 0 {
+		t.Fatalf("length %d not padded", len(w.buf))
+	}
+	r := &xdrReader{buf: w.buf}
+	if v := r.uint32(); v != 0xdeadbeef {
+		t.Errorf("uint32 %x", v)
+	}
+	if v := r.int32(); v != -2 {
+		t.Errorf("int32 %d", v)
+	}
+	if v := r.string(); v != "11/70" {
+		t.Errorf("string %q", v)
+	}
+	if v := r.opaque(); string(v) != "\x01\x02\x03\x04\x05" {
+		t.Errorf("opaque %v", v)
+	}
+	if r.err != nil {
+		t.Error(r.err)
+	}
+	r.uint32()
+	if r.err == nil {
+		t.Error("no error reading past the end")
+	}
+
+	infos := []ControlInfo{{Bytes: 1}, {Bytes: 3}, {Bytes: 2}}
+	values := []uint64{0x12, 0x345678, 0x9abc}
+	buf := EncodeValues(infos, values)
+	if len(buf) != 6 {
+		t.Fatalf("encoded %v", buf)
+	}
+	if got := DecodeValues(infos, buf); got[0] != values[0] || got[1] != values[1] || got[2] != values[2] {
+		t.Errorf("decoded %x, want %x", got, values)
+	}
+}
@@ -0,0 +1,77 @@
+package blinkenlight
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var errShortXDR = errors.New("xdr: short data")
+
+// Encoder of the XDR representation, RFC 4506.
+type xdrWriter struct {
+	buf []byte
+}
+
+func (w *xdrWriter) uint32(v uint32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+}
+
+func (w *xdrWriter) int32(v int32) {
+	w.uint32(uint32(v))
+}
+
+// Variable-length opaque data, padded to a multiple of 4 bytes.
+func (w *xdrWriter) opaque(b []byte) {
+	w.uint32(uint32(len(b)))
+	w.buf = append(w.buf, b...)
+	for len(w.buf)%4 != 0 {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *xdrWriter) string(s string) {
+	w.opaque([]byte(s))
+}
+
+// Decoder of the XDR representation. The first error is recorded, after
+// which the zero values are returned.
+type xdrReader struct {
+	buf []byte
+	err error
+}
+
+func (r *xdrReader) uint32() uint32 {
+	if r.err != nil {
+		return 0
+	}
+	if len(r.buf) < 4 {
+		r.err = errShortXDR
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.buf)
+	r.buf = r.buf[4:]
+	return v
+}
+
+func (r *xdrReader) int32() int32 {
+	return int32(r.uint32())
+}
+
+func (r *xdrReader) opaque() []byte {
+	n := int(r.uint32())
+	padded := (n + 3) &^ 3
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.buf) < padded {
+		r.err = errShortXDR
+		return nil
+	}
+	b := r.buf[:n:n]
+	r.buf = r.buf[padded:]
+	return b
+}
+
+func (r *xdrReader) string() string {
+	return string(r.opaque())
+}
@@ -0,0 +1,222 @@
+package pidp11
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// What to do with a new event when the buffer of a subscription is full.
+type OverflowPolicy int
+
+const (
+	DropOldest OverflowPolicy = iota
+	DropNewest
+	// Like DropOldest, but when the buffer is full a knob step is merged
+	// into the last undelivered event if it is a step of the same knob.
+	CoalesceKnobs
+)
+
+type SubscribeOptions struct {
+	IDs    []SwitchID  // only deliver the events for these switches, all if empty
+	Kinds  []EventKind // only deliver the events of these kinds, all if empty
+	Buffer int         // max number of undelivered events, 100 if 0
+	Policy OverflowPolicy
+}
+
+// A subscription to the panel events. Its channel is closed when the
+// subscription is closed or the panel stops.
+// The delivery of events to subscribers never blocks the main loop: if a
+// subscriber doesn't keep up, events are dropped according to its
+// overflow policy.
+type Subscription struct {
+	C       <-chan Event
+	c       chan Event
+	opts    SubscribeOptions
+	mu      sync.Mutex
+	queue   []Event
+	closing bool // deliver the queued events then close the channel
+	notify  chan struct{}
+	done    chan struct{} // closed by Close()
+	once    sync.Once
+	dropped atomic.Uint64
+	bus     *eventBus
+}
+
+type eventBus struct {
+	mu   sync.Mutex
+	subs []*Subscription
+}
+
+// Creates a subscription to the events of the panel.
+func (p *Panel) Subscribe(opts SubscribeOptions) *Subscription {
+	return p.bus.subscribe(opts)
+}
+
+func (bus *eventBus) subscribe(opts SubscribeOptions) *Subscription {
+	if opts.Buffer <= 0 {
+		opts.Buffer = 100
+	}
+	c := make(chan Event)
+	sub := &Subscription{
+		C:      c,
+		c:      c,
+		opts:   opts,
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		bus:    bus,
+	}
+	bus.mu.Lock()
+	bus.subs = append(bus.subs, sub)
+	bus.mu.Unlock()
+	go sub.pump()
+	return sub
+}
+
+// Delivers the event to the interested subscribers, without blocking.
+func (bus *eventBus) publish(evt Event) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	for _, sub := range bus.subs {
+		if sub.wants(evt) {
+			sub.push(evt)
+		}
+	}
+}
+
+// Closes the subscriptions once they have delivered their queued events.
+func (bus *eventBus) closeAll() {
+	bus.mu.Lock()
+	subs := bus.subs
+	bus.subs = nil
+	bus.mu.Unlock()
+	for _, sub := range subs {
+		sub.mu.Lock()
+		sub.closing = true
+		sub.mu.Unlock()
+		sub.wake()
+	}
+}
+
+func (bus *eventBus) remove(sub *Subscription) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	for i, s := range bus.subs {
+		if s == sub {
+			bus.subs = append(bus.subs[:i], bus.subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// Number of events dropped because the subscriber didn't keep up,
+// including the knob steps merged by CoalesceKnobs.
+func (sub *Subscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Stops the delivery of events, and closes the channel. Undelivered
+// events are discarded.
+func (sub *Subscription) Close() {
+	sub.bus.remove(sub)
+	sub.once.Do(func() { close(sub.done) })
+}
+
+func (sub *Subscription) wants(evt Event) bool {
+	if len(sub.opts.IDs) > 0 && !contains(sub.opts.IDs, evt.ID) {
+		return false
+	}
+	if len(sub.opts.Kinds) > 0 && !contains(sub.opts.Kinds, evt.Kind) {
+		return false
+	}
+	return true
+}
+
+func (sub *Subscription) push(evt Event) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	if len(sub.queue) >= sub.opts.Buffer {
+		if sub.opts.Policy == CoalesceKnobs && sub.coalesce(evt) {
+			return
+		}
+		sub.dropped.Add(1)
+		if sub.opts.Policy == DropNewest {
+			return
+		}
+		sub.queue = sub.queue[1:]
+	}
+	sub.queue = append(sub.queue, evt)
+	sub.wake()
+}
+
+// Merges the knob step into the last queued event if it is a step of the
+// same knob, returning false otherwise.
+// Must be called with the subscription locked.
+func (sub *Subscription) coalesce(evt Event) bool {
+	if len(sub.queue) == 0 || !isKnobStep(evt) {
+		return false
+	}
+	last := &sub.queue[len(sub.queue)-1]
+	if !isKnobStep(*last) || last.ID != evt.ID {
+		return false
+	}
+	evt.Delta += last.Delta
+	evt.On = evt.Delta > 0
+	if evt.Delta == 0 {
+		// The steps cancelled out, neither is delivered
+		sub.queue = sub.queue[:len(sub.queue)-1]
+		sub.dropped.Add(2)
+		return true
+	}
+	*last = evt
+	sub.dropped.Add(1)
+	return true
+}
+
+func (sub *Subscription) wake() {
+	select {
+	case sub.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Delivers the queued events to the channel.
+func (sub *Subscription) pump() {
+	defer close(sub.c)
+	for {
+		sub.mu.Lock()
+		if len(sub.queue) == 0 {
+			closing := sub.closing
+			sub.mu.Unlock()
+			if closing {
+				return
+			}
+			select {
+			case <-sub.notify:
+			case <-sub.done:
+				return
+			}
+			continue
+		}
+		evt := sub.queue[0]
+		sub.queue = sub.queue[1:]
+		sub.mu.Unlock()
+		select {
+		case sub.c <- evt:
+		case <-sub.done:
+			return
+		}
+	}
+}
+
+func isKnobStep(evt Event) bool {
+	return evt.Kind == KindChange && (evt.ID == SS_KNOBA || evt.ID == SS_KNOBD)
+}
+
+func contains[T comparable](items []T, item T) bool {
+	for _, it := range items {
+		if it == item {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package pidp11
+
+import "testing"
+
+func TestCoalesceKnobsOnlyWhenFull(t *testing.T) {
+	sub := &Subscription{
+		opts:   SubscribeOptions{Buffer: 3, Policy: CoalesceKnobs},
+		notify: make(chan struct{}, 1),
+	}
+	step := func(delta int) Event {
+		return Event{ID: SS_KNOBA, On: delta > 0, Delta: delta}
+	}
+	sub.push(step(1))
+	sub.push(step(1))
+	if len(sub.queue) != 2 || sub.Dropped() != 0 {
+		t.Fatalf("steps merged before the buffer is full: %v", sub.queue)
+	}
+	sub.push(step(1))
+	sub.push(step(2)) // full, merged into the last step
+	if len(sub.queue) != 3 || sub.queue[2].Delta != 3 || sub.Dropped() != 1 {
+		t.Fatalf("got %v, dropped %d", sub.queue, sub.Dropped())
+	}
+	sub.push(step(-3)) // cancels out the last step
+	if len(sub.queue) != 2 || sub.Dropped() != 3 {
+		t.Fatalf("got %v, dropped %d", sub.queue, sub.Dropped())
+	}
+	sub.push(Event{ID: SS_START, On: true})
+	sub.push(step(1)) // full, not after a step: drops the oldest
+	if len(sub.queue) != 3 || sub.queue[0].Delta != 1 || sub.queue[2].Delta != 1 || sub.Dropped() != 4 {
+		t.Fatalf("got %v, dropped %d", sub.queue, sub.Dropped())
+	}
+}
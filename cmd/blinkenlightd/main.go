@@ -0,0 +1,67 @@
+// Blinkenlight API server driving the panel, for the REALCONS console of
+// SimH:
+//
+//	blinkenlightd [-listen <addr>] [-register=false] [-mem]
+//
+// The server is registered with the local portmapper, where REALCONS
+// looks for it. With -mem the in-memory backend is used instead of the
+// GPIO pins, for trying it without the hardware.
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+
+	"github.com/lmittmann/tint"
+	"github.com/perpen/pidp11"
+	"github.com/perpen/pidp11/blinkenlight"
+)
+
+func main() {
+	listen := flag.String("listen", ":0", "address to listen on")
+	register := flag.Bool("register", true, "register with the local portmapper")
+	mem := flag.Bool("mem", false, "use the in-memory backend")
+	flag.Parse()
+
+	logger := slog.New(tint.NewHandler(os.Stderr, &tint.Options{
+		Level:   slog.LevelInfo,
+		NoColor: true,
+	}))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := []pidp11.Option{pidp11.WithLogger(logger), pidp11.WithKnobSelectors()}
+	if *mem {
+		opts = append(opts, pidp11.WithBackend(pidp11.NewMemBackend()))
+	}
+	if err := pidp11.Start(ctx, opts...); err != nil {
+		logger.Error("cannot start", "err", err)
+		os.Exit(1)
+	}
+	defer pidp11.Stop()
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		logger.Error("cannot listen", "err", err)
+		os.Exit(1)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	logger.Info("listening", "addr", l.Addr())
+	if *register {
+		if err := blinkenlight.Register(port); err != nil {
+			logger.Warn("cannot register with the portmapper", "err", err)
+		} else {
+			defer blinkenlight.Unregister()
+		}
+	}
+
+	server := blinkenlight.NewServer(pidp11.DefaultPanel(), logger)
+	if err := server.Serve(ctx, l); err != nil && ctx.Err() == nil {
+		logger.Error("server failed", "err", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log/slog"
 	"os"
 	"time"
@@ -15,24 +16,25 @@ func main() {
 		NoColor: true,
 	}))
 
-	if false {
-		// These settings are already set by default.
-
-		pidp11.SetBrightnessAdjust(1)
-
-		// These two next settings probably won't need to be changed
-		pidp11.SetBrightnessScaler(pidp11.NewLinearBrightnessScaler(
+	err := pidp11.Start(context.Background(),
+		pidp11.WithLogger(logger),
+		// The settings below are the defaults, and probably won't need
+		// to be changed.
+		pidp11.WithBrightnessAdjust(1),
+		pidp11.WithBrightnessScaler(pidp11.NewLinearBrightnessScaler(
 			.03, // minimum
 			1,   // max
-		))
-		pidp11.SetFrequencyScaler(pidp11.NewLinearFrequencyScaler(
+		)),
+		pidp11.WithFrequencyScaler(pidp11.NewLinearFrequencyScaler(
 			.5, // minimum frequency
 			10, // maximum frequency
 			.1, // we'll have 1Hz for this input value
-		))
+		)),
+	)
+	if err != nil {
+		logger.Error("cannot start", "err", err)
+		os.Exit(1)
 	}
-
-	pidp11.Start(logger)
 	defer pidp11.Stop()
 
 	lightshow := func() {
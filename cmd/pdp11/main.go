@@ -0,0 +1,78 @@
+// Runs the PDP-11 emulator on the panel, optionally loading an absolute
+// loader tape image, the console terminal being on stdin/stdout.
+//
+//	pdp11 [-lda <file>]
+//
+// The start address of the tape is loaded, so START runs it.
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/lmittmann/tint"
+	"github.com/perpen/pidp11"
+	"github.com/perpen/pidp11/cpu"
+)
+
+func main() {
+	ldaPath := flag.String("lda", "", "absolute loader tape image to load")
+	flag.Parse()
+
+	logger := slog.New(tint.NewHandler(os.Stderr, &tint.Options{
+		Level:   slog.LevelInfo,
+		NoColor: true,
+	}))
+
+	c := cpu.New(cpu.WithTerminal(os.Stdout))
+	if *ldaPath != "" {
+		f, err := os.Open(*ldaPath)
+		if err != nil {
+			logger.Error("cannot open tape", "err", err)
+			os.Exit(1)
+		}
+		start, err := c.LoadLDA(f)
+		f.Close()
+		if err != nil {
+			logger.Error("cannot load tape", "err", err)
+			os.Exit(1)
+		}
+		if start&1 == 0 {
+			c.SetPC(start)
+		}
+		logger.Info("loaded", "tape", *ldaPath, "start", start)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := pidp11.Start(ctx,
+		pidp11.WithLogger(logger), pidp11.WithKnobSelectors()); err != nil {
+		logger.Error("cannot start", "err", err)
+		os.Exit(1)
+	}
+	defer pidp11.Stop()
+
+	go func() {
+		in := bufio.NewReader(os.Stdin)
+		for {
+			b, err := in.ReadByte()
+			if err != nil {
+				return
+			}
+			if b == '\n' {
+				b = '\r'
+			}
+			c.Input(b)
+		}
+	}()
+
+	if err := c.Run(ctx, pidp11.DefaultPanel()); err != nil && ctx.Err() == nil {
+		logger.Error("stopped", "err", err)
+	}
+}
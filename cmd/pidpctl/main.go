@@ -0,0 +1,100 @@
+// Command-line client of pidpd, for scripts:
+//
+//	pidpctl [-socket <path>] led <name> <brightness> [<effect> [<param>...]]
+//	pidpctl [-socket <path>] clear [<offMs>]
+//	pidpctl [-socket <path>] brightness [<adjust>]
+//	pidpctl [-socket <path>] sr
+//	pidpctl [-socket <path>] events [--json]
+//	pidpctl [-socket <path>] claim <name>...
+//
+// For example "pidpctl led A3 1 flash 0.2". The values returned by the
+// daemon are printed on stdout, and the events one per line.
+//
+// As the leds are claimed until disconnecting, claim then sends the
+// requests read from stdin, one per line, keeping the claim until the end
+// of the input, eg:
+//
+//	(echo led A3 1 flash 0.2; sleep 10) | pidpctl claim A3
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/perpen/pidp11/daemon"
+)
+
+func main() {
+	socket := flag.String("socket", "/run/pidpd.sock", "path of the pidpd unix socket")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: pidpctl [-socket <path>] led|clear|brightness|sr|events|claim [<arg>...]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	client, err := daemon.Dial(*socket)
+	if err != nil {
+		fatal(err)
+	}
+	defer client.Close()
+
+	switch args[0] {
+	case "led", "clear", "brightness", "sr":
+		command(client, strings.Join(args, " "))
+	case "claim":
+		if len(args) == 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		command(client, strings.Join(args, " "))
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				command(client, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			fatal(err)
+		}
+	case "events":
+		asJSON := len(args) == 2 && args[1] == "--json"
+		if len(args) > 2 || len(args) == 2 && !asJSON {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err := client.Events(asJSON, func(evt string) bool {
+			_, err := fmt.Println(evt)
+			return err == nil
+		})
+		if err != nil {
+			fatal(err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+// Sends the request, printing the value returned.
+func command(client *daemon.Client, line string) {
+	val, err := client.Command(line)
+	if err != nil {
+		fatal(err)
+	}
+	if val != "" {
+		fmt.Println(val)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "pidpctl:", err)
+	os.Exit(1)
+}
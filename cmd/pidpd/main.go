@@ -0,0 +1,87 @@
+// Daemon owning the panel, so that it can be shared by several programs
+// and scripts, see the daemon package and pidpctl:
+//
+//	pidpd [-socket <path>] [-mem]
+//
+// With -mem the in-memory backend is used instead of the GPIO pins.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/lmittmann/tint"
+	"github.com/perpen/pidp11"
+	"github.com/perpen/pidp11/daemon"
+)
+
+func main() {
+	socket := flag.String("socket", "/run/pidpd.sock", "path of the unix socket")
+	mem := flag.Bool("mem", false, "use the in-memory backend")
+	flag.Parse()
+
+	logger := slog.New(tint.NewHandler(os.Stderr, &tint.Options{
+		Level:   slog.LevelInfo,
+		NoColor: true,
+	}))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Before starting the panel, which the running instance would own
+	if err := removeStaleSocket(*socket); err != nil {
+		logger.Error("cannot listen", "err", err)
+		os.Exit(1)
+	}
+	l, err := net.Listen("unix", *socket)
+	if err != nil {
+		logger.Error("cannot listen", "err", err)
+		os.Exit(1)
+	}
+	defer os.Remove(*socket)
+
+	opts := []pidp11.Option{pidp11.WithLogger(logger), pidp11.WithKnobSelectors()}
+	if *mem {
+		opts = append(opts, pidp11.WithBackend(pidp11.NewMemBackend()))
+	}
+	if err := pidp11.Start(ctx, opts...); err != nil {
+		logger.Error("cannot start", "err", err)
+		os.Remove(*socket)
+		os.Exit(1)
+	}
+	defer pidp11.Stop()
+	logger.Info("listening", "socket", *socket)
+
+	server := daemon.NewServer(pidp11.DefaultPanel(), logger)
+	if err := server.Serve(ctx, l); err != nil && ctx.Err() == nil {
+		logger.Error("server failed", "err", err)
+	}
+}
+
+// Removes the socket left behind by a previous instance which was killed,
+// failing if the path is not a socket or an instance is listening on it.
+func removeStaleSocket(path string) error {
+	fi, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("%s: not a socket", path)
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return fmt.Errorf("%s: already running", path)
+	}
+	return os.Remove(path)
+}
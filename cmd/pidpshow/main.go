@@ -0,0 +1,82 @@
+// Plays a light show script, see package show and demo.show:
+//
+//	pidpshow [-check] [-mem] <script>
+//
+// With -check the script is only parsed, reporting any errors. With -mem
+// the in-memory backend is used instead of the GPIO pins.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+
+	"github.com/lmittmann/tint"
+	"github.com/perpen/pidp11"
+	"github.com/perpen/pidp11/show"
+)
+
+func main() {
+	check := flag.Bool("check", false, "only check the syntax of the script")
+	mem := flag.Bool("mem", false, "use the in-memory backend")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: pidpshow [-check] [-mem] <script>")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	path := flag.Arg(0)
+
+	s, err := show.ParseFile(path)
+	if err != nil {
+		fatal(path, err)
+	}
+	if *check {
+		return
+	}
+
+	logger := slog.New(tint.NewHandler(os.Stderr, &tint.Options{
+		Level:   slog.LevelInfo,
+		NoColor: true,
+	}))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	opts := []pidp11.Option{pidp11.WithLogger(logger)}
+	if *mem {
+		opts = append(opts, pidp11.WithBackend(pidp11.NewMemBackend()))
+	}
+	if err := pidp11.Start(ctx, opts...); err != nil {
+		logger.Error("cannot start", "err", err)
+		os.Exit(1)
+	}
+	defer pidp11.Stop()
+
+	if err := s.Run(ctx, pidp11.DefaultPanel()); err != nil && ctx.Err() == nil {
+		pidp11.Stop()
+		fatal(path, err)
+	}
+}
+
+// Reports the error with the line of the script if known.
+func fatal(path string, err error) {
+	var syntaxErr *show.SyntaxError
+	var runErr *show.RunError
+	switch {
+	case errors.As(err, &syntaxErr):
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", path, syntaxErr.Line, syntaxErr.Msg)
+	case errors.As(err, &runErr):
+		fmt.Fprintf(os.Stderr, "%s:%d: %s\n", path, runErr.Line, runErr.Err)
+	default:
+		fmt.Fprintln(os.Stderr, "pidpshow:", err)
+	}
+	os.Exit(1)
+}
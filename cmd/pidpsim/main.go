@@ -0,0 +1,382 @@
+// Terminal simulator of the PiDP-11 panel.
+//
+// The real main loop runs against the in-memory backend, and the leds are
+// rendered with a shading reflecting their brightness. The keyboard
+// actions the switches:
+//   - a..v: register switches SR0..SR21
+//   - L, E, D, C, S: LOAD, EXAM, DEP, CONT, START
+//   - H: ENABLE/HALT, I: S_INST/S_BUS_CYCLE, T: TEST
+//   - 1, 2, 3: address knob anticlockwise, push, clockwise
+//   - 8, 9, 0: data knob anticlockwise, push, clockwise
+//   - Q: quit
+//
+// With -console, the LOAD, EXAM and DEP switches operate a 64KB memory
+// as on the 11/70 console. With -web, the panel is also served over HTTP,
+// eg -web localhost:8011.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/perpen/pidp11"
+	"github.com/perpen/pidp11/console"
+	"github.com/perpen/pidp11/web"
+)
+
+const (
+	refreshInterval = 50 * time.Millisecond
+	pressDuration   = 150 * time.Millisecond
+	knobInterval    = 10 * time.Millisecond
+	eventsShown     = 8
+)
+
+type simulator struct {
+	backend  *pidp11.MemBackend
+	levels   [72]int // brightness of each led, 0-31
+	lit      [72]uint64
+	refresh  [72]uint64
+	events   []string
+	knobLock [2]sync.Mutex
+	console  bool
+}
+
+func main() {
+	logPath := flag.String("log", "", "file to write the logs to")
+	withConsole := flag.Bool("console", false, "operate a memory from the console switches")
+	webAddr := flag.String("web", "", "address to serve the panel on over HTTP")
+	flag.Parse()
+
+	logOut := io.Discard
+	if *logPath != "" {
+		f, err := os.Create(*logPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		logOut = f
+	}
+	logger := slog.New(slog.NewTextHandler(logOut, &slog.HandlerOptions{
+		Level: slog.LevelInfo,
+	}))
+
+	sim := &simulator{backend: pidp11.NewMemBackend(), console: *withConsole}
+	if err := pidp11.Start(context.Background(),
+		pidp11.WithLogger(logger), pidp11.WithBackend(sim.backend)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer pidp11.Stop()
+
+	if *webAddr != "" {
+		handler := web.NewHandler(pidp11.DefaultPanel(), web.Config{Switches: sim.backend})
+		go func() {
+			if err := http.ListenAndServe(*webAddr, handler); err != nil {
+				logger.Error("web server failed", "err", err)
+			}
+		}()
+	}
+
+	restore, err := rawTerminal()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer restore()
+	fmt.Print("\x1b[2J\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\r\n")
+
+	keys := make(chan byte)
+	go func() {
+		buf := make([]byte, 1)
+		for {
+			if _, err := os.Stdin.Read(buf); err != nil {
+				close(keys)
+				return
+			}
+			keys <- buf[0]
+		}
+	}()
+
+	if sim.console {
+		go console.New(pidp11.DefaultPanel(), console.NewRAM(64*1024)).Run(context.Background())
+	} else {
+		lightshow()
+	}
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok || key == 'Q' || key == 3 { // 3 is ctrl-c
+				return
+			}
+			sim.handleKey(key)
+		case ev, ok := <-pidp11.Events():
+			if !ok {
+				return
+			}
+			sim.handleEvent(ev)
+		case <-ticker.C:
+			sim.render()
+		}
+	}
+}
+
+// Puts the terminal in raw mode, returns a function restoring its state.
+func rawTerminal() (func(), error) {
+	stty := func(args ...string) (string, error) {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		out, err := cmd.Output()
+		return strings.TrimSpace(string(out)), err
+	}
+	state, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("not a terminal? %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	return func() { stty(state) }, nil
+}
+
+func (sim *simulator) handleKey(key byte) {
+	switch {
+	case key >= 'a' && key <= 'v':
+		sim.flip(pidp11.SS_SR0 + pidp11.SwitchID(key-'a'))
+	case key == 'L':
+		sim.press(pidp11.SS_LOAD)
+	case key == 'E':
+		sim.press(pidp11.SS_EXAM)
+	case key == 'D':
+		sim.press(pidp11.SS_DEP)
+	case key == 'C':
+		sim.press(pidp11.SS_CONT)
+	case key == 'S':
+		sim.press(pidp11.SS_START)
+	case key == 'H':
+		sim.flip(pidp11.SS_HALT)
+	case key == 'I':
+		sim.flip(pidp11.SS_S_BUS_CYCLE)
+	case key == 'T':
+		sim.flip(pidp11.SS_TEST)
+	case key == '1' || key == '3':
+		sim.turn(0, pidp11.SS_KNOBA, key == '3')
+	case key == '2':
+		sim.press(pidp11.SS_KNOBA_PUSH)
+	case key == '8' || key == '0':
+		sim.turn(1, pidp11.SS_KNOBD, key == '0')
+	case key == '9':
+		sim.press(pidp11.SS_KNOBD_PUSH)
+	}
+}
+
+// Flips the toggle from its position as read by the panel, as it may also
+// have been changed over HTTP.
+func (sim *simulator) flip(id pidp11.SwitchID) {
+	sim.backend.SetSwitchByID(id, !pidp11.SwitchState(id))
+}
+
+// Momentary switches are released after a short while, as the terminal
+// doesn't tell us when the key is released.
+func (sim *simulator) press(id pidp11.SwitchID) {
+	sim.backend.SetSwitchByID(id, true)
+	time.AfterFunc(pressDuration, func() {
+		sim.backend.SetSwitchByID(id, false)
+	})
+}
+
+func (sim *simulator) turn(knob int, id pidp11.SwitchID, cw bool) {
+	go func() {
+		sim.knobLock[knob].Lock()
+		defer sim.knobLock[knob].Unlock()
+		sim.backend.TurnKnob(id, cw, knobInterval)
+	}()
+}
+
+// Some behaviour for showing off the effects: the register switches are
+// mirrored on the address leds, START runs the lightshow and the data
+// knob push clears the leds. Not in console mode, which uses the leds.
+func (sim *simulator) handleEvent(ev pidp11.Event) {
+	sim.events = append(sim.events, ev.String())
+	if len(sim.events) > eventsShown {
+		sim.events = sim.events[1:]
+	}
+	if sim.console {
+		return
+	}
+	switch {
+	case ev.ID >= pidp11.SS_SR0 && ev.ID <= pidp11.SS_SR21:
+		bright := 0.0
+		if ev.On {
+			bright = 1
+		}
+		led := pidp11.LED_A0 + pidp11.LedID(ev.ID-pidp11.SS_SR0)
+		pidp11.Led(led, bright, pidp11.NewSimpleEffect(300, 300))
+	case ev.ID == pidp11.SS_START:
+		pidp11.ClearLeds(0)
+		lightshow()
+	case ev.ID == pidp11.SS_KNOBD_PUSH:
+		pidp11.ClearLeds(1000)
+	}
+}
+
+func lightshow() {
+	const param = 0.1
+	pidp11.Led(pidp11.LED_RUN, 1, pidp11.NewFlashEffect(250, 250), param)
+	pidp11.Led(pidp11.LED_PAUSE, 1, pidp11.NewStrobeEffect(0, 500), param)
+	pidp11.Led(pidp11.LED_PAR_ERR, 1, pidp11.NewErrorEffect())
+	pidp11.Led(pidp11.LED_KERNEL, 1, pidp11.NewSimpleEffect(0, 0))
+	pidp11.Led(pidp11.LED_DATA, 1, pidp11.NewSimpleEffect(3000, 0))
+	for i := range 16 {
+		pidp11.Led(pidp11.LED_D0+pidp11.LedID(i), float64(i+1)/16,
+			pidp11.NewSimpleEffect(0, 0))
+	}
+}
+
+// Rows of the panel, as label and leds. A negative LedID leaves a gap.
+var panelRows = []struct {
+	label string
+	leds  []pidp11.LedID
+}{
+	{"ADDRESS", ledRange(pidp11.LED_A21, pidp11.LED_A0)},
+	{"DATA", append(gap(6), ledRange(pidp11.LED_D15, pidp11.LED_D0)...)},
+	{"STATUS", []pidp11.LedID{
+		pidp11.LED_PAR_ERR, pidp11.LED_ADRS_ERR, pidp11.LED_RUN,
+		pidp11.LED_PAUSE, pidp11.LED_MASTER, pidp11.LED_USER,
+		pidp11.LED_SUPER, pidp11.LED_KERNEL, pidp11.LED_DATA,
+		pidp11.LED_ADDR_16, pidp11.LED_ADDR_18, pidp11.LED_ADDR_22,
+		pidp11.LED_PAR_HI, pidp11.LED_PAR_LO,
+	}},
+	{"ADDR KNOB", []pidp11.LedID{
+		pidp11.LED_USER_D, pidp11.LED_SUPER_D, pidp11.LED_KERNEL_D,
+		pidp11.LED_CONS_PHY, pidp11.LED_USER_I, pidp11.LED_SUPER_I,
+		pidp11.LED_KERNEL_I, pidp11.LED_PROG_PHY,
+	}},
+	{"DATA KNOB", []pidp11.LedID{
+		pidp11.LED_DATA_PATHS, pidp11.LED_BUS_REG,
+		pidp11.LED_μADR_FPP_CPU, pidp11.LED_DISPLAY_REGISTER,
+	}},
+	{"UNUSED", []pidp11.LedID{
+		pidp11.LED_UNUSED1, pidp11.LED_UNUSED2, pidp11.LED_UNUSED3,
+		pidp11.LED_UNUSED4, pidp11.LED_UNUSED5, pidp11.LED_UNUSED6,
+		pidp11.LED_UNUSED7, pidp11.LED_UNUSED8,
+	}},
+}
+
+func ledRange(from, to pidp11.LedID) []pidp11.LedID {
+	var ids []pidp11.LedID
+	for id := from; id >= to; id-- {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func gap(n int) []pidp11.LedID {
+	ids := make([]pidp11.LedID, n)
+	for i := range ids {
+		ids[i] = -1
+	}
+	return ids
+}
+
+// Updates the brightness of the leds from the proportion of refreshes
+// they were lit since the last call.
+func (sim *simulator) updateLevels() {
+	for id := range sim.levels {
+		lit, refresh := sim.backend.LedStats(pidp11.LedID(id))
+		if refresh > sim.refresh[id] {
+			duty := float64(lit-sim.lit[id]) / float64(refresh-sim.refresh[id])
+			sim.levels[id] = int(math.Round(duty * 31))
+		}
+		sim.lit[id], sim.refresh[id] = lit, refresh
+	}
+}
+
+func (sim *simulator) render() {
+	sim.updateLevels()
+	var sb strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&sb, format+"\x1b[K\r\n", args...)
+	}
+	sb.WriteString("\x1b[H")
+	line("PiDP-11 simulator")
+	line("")
+	for _, row := range panelRows {
+		var names, glyphs strings.Builder
+		for _, id := range row.leds {
+			if id < 0 {
+				names.WriteString("   ")
+				glyphs.WriteString("   ")
+				continue
+			}
+			name := strings.TrimPrefix(strings.TrimPrefix(pidp11.LedName(id), "A"), "D")
+			if len(row.leds) < 22 {
+				name = pidp11.LedName(id)
+			}
+			width := max(3, len([]rune(name))+1)
+			fmt.Fprintf(&names, "%*s", width, name)
+			fmt.Fprintf(&glyphs, "%*s%s", width-1, "", ledGlyph(sim.levels[id]))
+		}
+		line("%-10s%s", row.label, names.String())
+		line("%-10s%s", "", glyphs.String())
+	}
+	line("")
+	var keys, positions strings.Builder
+	for n := 21; n >= 0; n-- {
+		fmt.Fprintf(&keys, "%3c", 'a'+n)
+		fmt.Fprintf(&positions, "%3s", switchGlyph(pidp11.SwitchState(pidp11.SS_SR0+pidp11.SwitchID(n))))
+	}
+	line("%-10s%s", "SWITCHES", positions.String())
+	line("%-10s%s", "keys", keys.String())
+	line("")
+	line("%-10s TEST(T)=%s  ENABLE/HALT(H)=%s  S_INST/S_BUS_CYCLE(I)=%s",
+		"TOGGLES", onOff(pidp11.SwitchState(pidp11.SS_TEST), "on", "off"),
+		onOff(pidp11.SwitchState(pidp11.SS_HALT), "HALT", "ENABLE"),
+		onOff(pidp11.SwitchState(pidp11.SS_S_BUS_CYCLE), "S_BUS_CYCLE", "S_INST"))
+	line("%-10s LOAD(L) EXAM(E) DEP(D) CONT(C) START(S)", "MOMENTARY")
+	line("%-10s address 1/2/3, data 8/9/0 (anticlockwise/push/clockwise)", "KNOBS")
+	line("%-10s Q", "QUIT")
+	line("")
+	line("Events:")
+	for i := range eventsShown {
+		if i < len(sim.events) {
+			line("  %s", sim.events[i])
+		} else {
+			line("")
+		}
+	}
+	fmt.Print(sb.String())
+}
+
+func ledGlyph(level int) string {
+	if level == 0 {
+		return "\x1b[38;5;238m●\x1b[0m"
+	}
+	f := float64(level) / 31
+	return fmt.Sprintf("\x1b[38;2;%d;%d;0m●\x1b[0m",
+		int(70+185*f), int(10+60*f))
+}
+
+func switchGlyph(up bool) string {
+	return onOff(up, "▲", "▽")
+}
+
+func onOff(b bool, on, off string) string {
+	if b {
+		return on
+	}
+	return off
+}
@@ -0,0 +1,135 @@
+// Package console implements the LOAD ADRS, EXAM and DEP functions of the
+// PDP-11/70 console on top of the panel, for toggling in programs without
+// an emulator.
+package console
+
+import (
+	"context"
+	"sync"
+
+	"github.com/perpen/pidp11"
+)
+
+const addrMask = 1<<22 - 1
+
+type operation int
+
+const (
+	opNone operation = iota
+	opExam
+	opDep
+)
+
+type Console struct {
+	panel  *pidp11.Panel
+	mem    Memory
+	fx     pidp11.Effect
+	mu     sync.Mutex
+	addr   uint32
+	last   operation // for the auto-increment of consecutive EXAM/DEP
+	data   uint16
+	failed bool // last access was to non-existent memory
+}
+
+// Creates a console operating the memory from the switches of the panel.
+func New(panel *pidp11.Panel, mem Memory) *Console {
+	return &Console{
+		panel: panel,
+		mem:   mem,
+		fx:    pidp11.NewSimpleEffect(0, 0),
+	}
+}
+
+// Handles the LOAD, EXAM and DEP switches until the context is done or
+// the panel stops.
+func (c *Console) Run(ctx context.Context) error {
+	sub := c.panel.Subscribe(pidp11.SubscribeOptions{
+		IDs:   []pidp11.SwitchID{pidp11.SS_LOAD, pidp11.SS_EXAM, pidp11.SS_DEP},
+		Kinds: []pidp11.EventKind{pidp11.KindChange},
+	})
+	defer sub.Close()
+	c.mu.Lock()
+	c.show()
+	c.mu.Unlock()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case evt, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if !evt.On {
+				continue
+			}
+			sr := c.panel.ReadRegSwitches()
+			switch evt.ID {
+			case pidp11.SS_LOAD:
+				c.Load(uint32(sr))
+			case pidp11.SS_EXAM:
+				c.Exam()
+			case pidp11.SS_DEP:
+				c.Deposit(uint16(sr))
+			}
+		}
+	}
+}
+
+// Returns the current address.
+func (c *Console) Address() uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addr
+}
+
+// LOAD ADRS: sets the current address.
+func (c *Console) Load(addr uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.addr = addr & addrMask
+	c.last = opNone
+	c.failed = false
+	c.show()
+}
+
+// EXAM: reads the word at the current address, after moving to the next
+// word if the previous operation was also an EXAM.
+func (c *Console) Exam() (uint16, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance(opExam)
+	val, err := c.mem.Read(c.addr)
+	c.data, c.failed = val, err != nil
+	c.show()
+	return val, err
+}
+
+// DEP: writes the word at the current address, after moving to the next
+// word if the previous operation was also a DEP.
+func (c *Console) Deposit(val uint16) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.advance(opDep)
+	err := c.mem.Write(c.addr, val)
+	c.data, c.failed = val, err != nil
+	c.show()
+	return err
+}
+
+func (c *Console) advance(op operation) {
+	if c.last == op && !c.failed {
+		c.addr = (c.addr + 2) & addrMask
+	}
+	c.last = op
+}
+
+// Must be called with the mutex held.
+func (c *Console) show() {
+	c.panel.ShowAddress(uint(c.addr), pidp11.Addr22, c.fx)
+	c.panel.ShowData(c.data, c.fx)
+	if c.failed {
+		c.panel.Led(pidp11.LED_ADRS_ERR, 1, c.fx)
+	} else {
+		c.panel.Led(pidp11.LED_ADRS_ERR, 0, c.fx)
+	}
+}
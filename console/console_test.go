@@ -0,0 +1,172 @@
+package console
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+type front struct {
+	t     *testing.T
+	panel *pidp11.Panel
+	mem   *pidp11.MemBackend
+	cons  *Console
+	ram   *RAM
+}
+
+// Starts a panel on the in-memory backend, and a console with 64 bytes of
+// RAM on it.
+func start(t *testing.T) *front {
+	t.Helper()
+	mem := pidp11.NewMemBackend()
+	panel := pidp11.NewPanel(
+		pidp11.WithBackend(mem),
+		pidp11.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err := panel.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { panel.Stop() })
+	ram := NewRAM(64)
+	cons := New(panel, ram)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		cons.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return &front{t, panel, mem, cons, ram}
+}
+
+// Fails unless the condition becomes true within a second.
+func (f *front) eventually(what string, cond func() bool) {
+	f.t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			f.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (f *front) setSR(val uint) {
+	f.t.Helper()
+	for bit := range 22 {
+		f.mem.SetSwitchByID(pidp11.SS_SR0+pidp11.SwitchID(bit), val>>bit&1 != 0)
+	}
+	f.eventually("switch register", func() bool { return f.panel.ReadRegSwitches() == val })
+}
+
+// Presses the switch, waiting for the console to handle it.
+func (f *front) press(id pidp11.SwitchID, handled func() bool) {
+	f.t.Helper()
+	f.mem.SetSwitchByID(id, true)
+	f.eventually(pidp11.SwitchName(id), func() bool { return f.panel.SwitchState(id) })
+	f.eventually(pidp11.SwitchName(id)+" handled", handled)
+	f.mem.SetSwitchByID(id, false)
+	f.eventually(pidp11.SwitchName(id)+" released", func() bool { return !f.panel.SwitchState(id) })
+}
+
+func (f *front) load(addr uint) {
+	f.t.Helper()
+	f.setSR(addr)
+	f.press(pidp11.SS_LOAD, func() bool { return f.cons.Address() == uint32(addr) })
+}
+
+func (f *front) lit(id pidp11.LedID) bool {
+	return f.panel.CaptureScene().Led(id).Brightness == 1
+}
+
+// Returns the value shown on the data leds.
+func (f *front) data() uint16 {
+	var val uint16
+	for bit := range 16 {
+		if f.lit(pidp11.LED_D0 + pidp11.LedID(bit)) {
+			val |= 1 << bit
+		}
+	}
+	return val
+}
+
+func TestLoad(t *testing.T) {
+	f := start(t)
+	f.load(0o24)
+	for bit := range 22 {
+		if want := 0o24>>bit&1 != 0; f.lit(pidp11.LED_A0+pidp11.LedID(bit)) != want {
+			t.Errorf("A%d lit %v, want %v", bit, !want, want)
+		}
+	}
+	// Latched: changing the switches doesn't change the address
+	f.setSR(0o7)
+	time.Sleep(20 * time.Millisecond)
+	if addr := f.cons.Address(); addr != 0o24 {
+		t.Errorf("address %o after changing the switches", addr)
+	}
+}
+
+func TestDepositAndExamine(t *testing.T) {
+	f := start(t)
+	f.load(0o10)
+	for i, val := range []uint{0o1111, 0o2222, 0o3333} {
+		f.setSR(val)
+		addr := uint32(0o10 + 2*i)
+		f.press(pidp11.SS_DEP, func() bool {
+			word, _ := f.ram.Read(addr)
+			return word == uint16(val)
+		})
+		if f.cons.Address() != addr {
+			t.Errorf("deposit %d at %o, want %o", i, f.cons.Address(), addr)
+		}
+	}
+
+	// LOAD resets the increment
+	f.load(0o10)
+	for i, want := range []uint16{0o1111, 0o2222, 0o3333} {
+		addr := uint32(0o10 + 2*i)
+		f.press(pidp11.SS_EXAM, func() bool { return f.cons.Address() == addr && f.data() == want })
+	}
+	// DEP after EXAM doesn't move to the next word
+	f.setSR(0o4444)
+	f.press(pidp11.SS_DEP, func() bool {
+		word, _ := f.ram.Read(0o14)
+		return word == 0o4444
+	})
+}
+
+func TestNonExistentMemory(t *testing.T) {
+	f := start(t)
+	f.load(0o76)
+	f.press(pidp11.SS_EXAM, func() bool { return f.cons.Address() == 0o76 })
+	if f.lit(pidp11.LED_ADRS_ERR) {
+		t.Error("ADRS ERR lit for existing memory")
+	}
+	f.press(pidp11.SS_EXAM, func() bool { return f.lit(pidp11.LED_ADRS_ERR) })
+	if addr := f.cons.Address(); addr != 0o100 {
+		t.Errorf("address %o, want 100", addr)
+	}
+	// No increment after a failed access
+	f.press(pidp11.SS_EXAM, func() bool { return true })
+	time.Sleep(20 * time.Millisecond)
+	if addr := f.cons.Address(); addr != 0o100 || !f.lit(pidp11.LED_ADRS_ERR) {
+		t.Errorf("address %o, ADRS ERR %v, want 100 and lit", addr, f.lit(pidp11.LED_ADRS_ERR))
+	}
+	f.setSR(0o1234)
+	f.press(pidp11.SS_DEP, func() bool { return true })
+	time.Sleep(20 * time.Millisecond)
+	if addr := f.cons.Address(); addr != 0o100 || !f.lit(pidp11.LED_ADRS_ERR) {
+		t.Errorf("after DEP: address %o, ADRS ERR %v, want 100 and lit", addr, f.lit(pidp11.LED_ADRS_ERR))
+	}
+	f.load(0)
+	if f.lit(pidp11.LED_ADRS_ERR) {
+		t.Error("ADRS ERR still lit after LOAD")
+	}
+}
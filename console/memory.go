@@ -0,0 +1,48 @@
+package console
+
+import (
+	"errors"
+	"sync"
+)
+
+// Returned when accessing an address outside of the memory.
+var ErrNonExistent = errors.New("non-existent memory")
+
+// The memory examined and deposited into from the console.
+// The addresses are byte addresses, the words being at even addresses.
+type Memory interface {
+	Read(addr uint32) (uint16, error)
+	Write(addr uint32, val uint16) error
+}
+
+// In-memory implementation of Memory.
+type RAM struct {
+	mu    sync.Mutex
+	words []uint16
+}
+
+// Creates a memory of the given size in bytes, initially zeroed.
+func NewRAM(size uint32) *RAM {
+	return &RAM{words: make([]uint16, size/2)}
+}
+
+func (r *RAM) Read(addr uint32) (uint16, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := addr / 2
+	if i >= uint32(len(r.words)) {
+		return 0, ErrNonExistent
+	}
+	return r.words[i], nil
+}
+
+func (r *RAM) Write(addr uint32, val uint16) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := addr / 2
+	if i >= uint32(len(r.words)) {
+		return ErrNonExistent
+	}
+	r.words[i] = val
+	return nil
+}
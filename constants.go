@@ -1,8 +1,17 @@
 package pidp11
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
 
 const antiGhostingPauseNs = 1e4
+
+// Approx. duration of a loop before Start() has timed it, mostly the
+// pauses of the 6 led rows.
+const nominalLoopμs = 400
+
 const ledsCount = 72
 
 var ledRows = [...]uint{20, 21, 22, 23, 24, 25}
@@ -22,6 +31,35 @@ func LedIDByName(name string) LedID {
 	panic(fmt.Errorf("invalid led name: %s", name))
 }
 
+// Returns the ID of the led with the given name, eg "A0".
+func LookupLed(name string) (LedID, bool) {
+	for i, ledName := range ledNames {
+		if ledName == name {
+			return LedID(i), true
+		}
+	}
+	return 0, false
+}
+
+// Returns the names of all the leds, indexed by LedID.
+func LedNames() []string {
+	return append([]string(nil), ledNames...)
+}
+
+func SwitchName(id SwitchID) string {
+	return switchNames[id]
+}
+
+// Returns the ID of the switch with the given name, eg "SR0".
+func LookupSwitch(name string) (SwitchID, bool) {
+	for i, switchName := range switchNames {
+		if switchName == name && SwitchID(i) != SS_NIL {
+			return SwitchID(i), true
+		}
+	}
+	return 0, false
+}
+
 func LedNameByID(id LedID) string {
 	for i, name := range ledNames {
 		if i == int(id) {
@@ -36,9 +74,44 @@ func (evt Event) String() string {
 	if evt.On {
 		onOff = "on"
 	}
+	if evt.Kind != KindChange {
+		onOff = evt.Kind.String()
+	}
+	if evt.Kind == KindRegister {
+		onOff = FormatOctal(evt.Previous, 22) + " → " + FormatOctal(evt.Value, 22)
+	}
+	if evt.Name != "" {
+		return fmt.Sprintf("%s (%s)", evt.Name, onOff)
+	}
 	return fmt.Sprintf("%s (%s)", switchNames[evt.ID], onOff)
 }
 
+// Encodes the event with the names of the switch and kind, eg
+// {"switch":"SR3","kind":"change","on":true,...}.
+func (evt Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Switch   string `json:"switch"`
+		Kind     string `json:"kind"`
+		On       bool   `json:"on"`
+		Delta    int    `json:"delta,omitempty"`
+		Name     string `json:"name,omitempty"`
+		Value    uint   `json:"value,omitempty"`
+		Previous uint   `json:"previous,omitempty"`
+		Time     string `json:"time"`
+		Scan     uint64 `json:"scan"`
+	}{
+		Switch:   evt.SwitchName(),
+		Kind:     evt.Kind.String(),
+		On:       evt.On,
+		Delta:    evt.Delta,
+		Name:     evt.Name,
+		Value:    evt.Value,
+		Previous: evt.Previous,
+		Time:     evt.Time.Format(time.RFC3339Nano),
+		Scan:     evt.Scan,
+	})
+}
+
 func (evt Event) SwitchName() string {
 	return switchNames[evt.ID]
 }
@@ -225,10 +298,10 @@ const (
 	SS_EXAM
 	SS_DEP
 	SS_CONT
-	SS_ENABLE
-	SS_HALT
-	SS_S_INST
-	SS_S_BUS_CYCLE
+	SS_ENABLE      // never emitted, the events of ENABLE/HALT are SS_HALT; only for SwitchState()
+	SS_HALT        // on in the HALT position, off in the ENABLE one
+	SS_S_INST      // never emitted, the events of S_INST/S_BUS_CYCLE are SS_S_BUS_CYCLE; only for SwitchState()
+	SS_S_BUS_CYCLE // on in the S_BUS_CYCLE position, off in the S_INST one
 	SS_START
 	SS_KNOBA
 	SS_KNOBD
@@ -254,6 +327,7 @@ const (
 	SS_SR19
 	SS_SR20
 	SS_SR21
+	SS_REGISTER // the register switches as a whole, see KindRegister
 )
 
 var switchNames = []string{
@@ -294,6 +368,7 @@ var switchNames = []string{
 	"SR19",
 	"SR20",
 	"SR21",
+	"REGISTER",
 }
 
 // Low-level representation of the switches
@@ -0,0 +1,120 @@
+package cpu
+
+import (
+	"github.com/perpen/pidp11/console"
+)
+
+// Physical addresses of the I/O page as seen from the console
+const (
+	ioPage18 = 0o760000
+	ioPage22 = 0o17760000
+)
+
+// Reads a word at a physical address, to implement console.Memory.
+// The I/O page is at 160000, 760000 and 17760000.
+func (c *CPU) Read(addr uint32) (uint16, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	busAddr, ok := physToBus(addr)
+	if !ok {
+		return 0, console.ErrNonExistent
+	}
+	val, ok := c.busRead(busAddr&^1, false)
+	if !ok {
+		return 0, console.ErrNonExistent
+	}
+	return val, nil
+}
+
+// Writes a word at a physical address, to implement console.Memory.
+func (c *CPU) Write(addr uint32, val uint16) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	busAddr, ok := physToBus(addr)
+	if !ok || !c.busWrite(busAddr&^1, val, false) {
+		return console.ErrNonExistent
+	}
+	return nil
+}
+
+func physToBus(addr uint32) (uint16, bool) {
+	switch {
+	case addr < ioPage+0o20000:
+		return uint16(addr), true
+	case addr >= ioPage18 && addr < ioPage18+0o20000:
+		return uint16(addr - ioPage18 + ioPage), true
+	case addr >= ioPage22 && addr < ioPage22+0o20000:
+		return uint16(addr - ioPage22 + ioPage), true
+	}
+	return 0, false
+}
+
+// Bus accesses by the instructions, which trap on errors.
+
+func (c *CPU) read16(addr uint16) uint16 {
+	if addr&1 != 0 {
+		panic(exception{vecBus})
+	}
+	val, ok := c.busRead(addr, false)
+	if !ok {
+		panic(exception{vecBus})
+	}
+	c.busAddr, c.busData = addr, val
+	return val
+}
+
+func (c *CPU) read8(addr uint16) uint16 {
+	val, ok := c.busRead(addr&^1, false)
+	if !ok {
+		panic(exception{vecBus})
+	}
+	c.busAddr, c.busData = addr, val
+	if addr&1 != 0 {
+		val >>= 8
+	}
+	return val & 0xff
+}
+
+func (c *CPU) write16(addr, val uint16) {
+	if addr&1 != 0 || !c.busWrite(addr, val, false) {
+		panic(exception{vecBus})
+	}
+	c.busAddr, c.busData = addr, val
+}
+
+func (c *CPU) write8(addr, val uint16) {
+	if !c.busWrite(addr, val&0xff, true) {
+		panic(exception{vecBus})
+	}
+	c.busAddr, c.busData = addr, val&0xff
+}
+
+// Reads the word at an even address, without the side effects of reading
+// device registers if peek.
+func (c *CPU) busRead(addr uint16, peek bool) (uint16, bool) {
+	if addr < ioPage {
+		return c.mem[addr/2], true
+	}
+	return c.ioRead(addr, peek)
+}
+
+// Writes a word at an even address, or a byte at any address.
+func (c *CPU) busWrite(addr, val uint16, isByte bool) bool {
+	if isByte {
+		old, ok := c.busRead(addr&^1, true)
+		if !ok {
+			return false
+		}
+		if addr&1 != 0 {
+			val = old&0xff | val<<8
+		} else {
+			val = old&0xff00 | val
+		}
+		addr &^= 1
+	}
+	if addr < ioPage {
+		c.mem[addr/2] = val
+		return true
+	}
+	return c.ioWrite(addr, val)
+}
@@ -0,0 +1,209 @@
+// Package cpu is a minimal PDP-11 emulator with the basic instruction set
+// and 64KB of memory, operated from the panel, see Run().
+//
+// There is no memory management: the top 8KB of the 16-bit address
+// space is the I/O page, with the switch and display registers at 177570,
+// the PSW at 177776 and a DL11 console terminal at 177560.
+package cpu
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	ioPage     = 0o160000 // start of the I/O page
+	defaultIPS = 1000000
+)
+
+// PSW bits
+const (
+	flagC = 1 << iota
+	flagV
+	flagZ
+	flagN
+	flagT
+)
+
+// Trap vectors
+const (
+	vecBus      = 0o4
+	vecReserved = 0o10
+	vecBPT      = 0o14
+	vecIOT      = 0o20
+	vecEMT      = 0o30
+	vecTRAP     = 0o34
+)
+
+// Panicked during the execution of an instruction, to abort it and trap.
+type exception struct {
+	vector uint16
+}
+
+type CPU struct {
+	mu      sync.Mutex
+	r       [8]uint16
+	psw     uint16
+	mem     [ioPage / 2]uint16
+	halted  bool
+	waiting bool
+	ips     int           // instructions per second when running
+	sr      func() uint16 // switch register
+	dr      uint16        // display register
+	busAddr uint16        // last bus cycle
+	busData uint16
+	tty     dl11
+}
+
+type Option func(*CPU)
+
+// Sets the speed, in instructions per second, default 1000000.
+func WithSpeed(ips int) Option {
+	return func(c *CPU) {
+		c.ips = ips
+	}
+}
+
+// Sets where the output of the console terminal goes.
+func WithTerminal(out io.Writer) Option {
+	return func(c *CPU) {
+		c.tty.out = out
+	}
+}
+
+// Creates a halted CPU, with zeroed memory.
+func New(opts ...Option) *CPU {
+	c := &CPU{
+		halted: true,
+		ips:    defaultIPS,
+		sr:     func() uint16 { return 0 },
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.tty.reset()
+	return c
+}
+
+// Initialises the PSW and the devices, as done by START.
+func (c *CPU) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.psw = 0
+	c.waiting = false
+	c.tty.reset()
+}
+
+// Returns the registers R0..R7 and the PSW.
+func (c *CPU) Registers() ([8]uint16, uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.r, c.psw
+}
+
+func (c *CPU) SetPC(pc uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.r[7] = pc
+}
+
+func (c *CPU) Halted() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.halted
+}
+
+// Feeds a character to the console terminal.
+func (c *CPU) Input(b byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.tty.input(b)
+}
+
+// Executes one instruction, or takes a pending interrupt.
+// Does nothing if halted.
+func (c *CPU) Step() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.step()
+}
+
+// Must be called with the mutex held.
+func (c *CPU) step() {
+	if c.halted {
+		return
+	}
+	c.tty.tick()
+	if vector, ok := c.interrupt(); ok {
+		c.waiting = false
+		c.trap(vector)
+		return
+	}
+	if c.waiting {
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			exc, ok := r.(exception)
+			if !ok {
+				panic(r)
+			}
+			c.trap(exc.vector)
+		}
+	}()
+	traced := c.psw&flagT != 0
+	if !c.execute(c.fetch()) && traced && !c.halted {
+		c.trap(vecBPT)
+	}
+}
+
+// Returns the vector of the pending interrupt with the highest priority,
+// if above the priority of the processor.
+func (c *CPU) interrupt() (uint16, bool) {
+	if c.psw>>5&7 >= dl11Priority {
+		return 0, false
+	}
+	return c.tty.interrupt()
+}
+
+// Pushes the PSW and PC, and loads them from the vector.
+// A failure to do so halts the processor.
+func (c *CPU) trap(vector uint16) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(exception); !ok {
+				panic(r)
+			}
+			c.halted = true
+		}
+	}()
+	old := c.psw
+	pc := c.read16(vector)
+	psw := c.read16(vector + 2)
+	c.push(old)
+	c.push(c.r[7])
+	c.r[7] = pc
+	// The previous mode is the mode before the trap
+	c.psw = psw&^0o30000 | old>>2&0o30000
+}
+
+func (c *CPU) fetch() uint16 {
+	ins := c.read16(c.r[7])
+	c.r[7] += 2
+	return ins
+}
+
+func (c *CPU) push(val uint16) {
+	c.r[6] -= 2
+	c.write16(c.r[6], val)
+}
+
+func (c *CPU) pop() uint16 {
+	val := c.read16(c.r[6])
+	c.r[6] += 2
+	return val
+}
+
+func (c *CPU) kernel() bool {
+	return c.psw>>14 == 0
+}
@@ -0,0 +1,226 @@
+package cpu
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// Loads the words at 1000, and runs them from there until halted.
+func run(t *testing.T, c *CPU, words ...uint16) ([8]uint16, uint16) {
+	t.Helper()
+	load(t, c, 0o1000, words...)
+	c.SetPC(0o1000)
+	c.halted = false
+	for range 10000 {
+		c.Step()
+		if c.Halted() {
+			return c.Registers()
+		}
+	}
+	t.Fatal("not halted")
+	return [8]uint16{}, 0
+}
+
+func load(t *testing.T, c *CPU, addr uint32, words ...uint16) {
+	t.Helper()
+	for i, w := range words {
+		if err := c.Write(addr+uint32(2*i), w); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestFactorial(t *testing.T) {
+	r, _ := run(t, New(),
+		0o012700, 5, // MOV #5, R0
+		0o012701, 1, // MOV #1, R1
+		0o070100, // MUL R0, R1
+		0o077002, // SOB R0, .-2
+		0o000000, // HALT
+	)
+	if r[1] != 120 {
+		t.Errorf("R1 = %d, want 120", r[1])
+	}
+}
+
+func TestConditionCodes(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ins  []uint16
+		psw  uint16
+	}{
+		{"INC overflow", []uint16{0o012700, 0o077777, 0o005200}, flagN | flagV},
+		{"DEC to zero", []uint16{0o012700, 1, 0o005300}, flagZ},
+		{"ADD carry", []uint16{0o012700, 0o177777, 0o062700, 1}, flagZ | flagC},
+		{"CMP less", []uint16{0o012700, 1, 0o020027, 2}, flagN | flagC},
+		{"TST negative", []uint16{0o012700, 0o100000, 0o005700}, flagN},
+	} {
+		_, psw := run(t, New(), append(tc.ins, 0)...)
+		if psw&0o17 != tc.psw {
+			t.Errorf("%s: condition codes %02o, want %02o", tc.name, psw&0o17, tc.psw)
+		}
+	}
+}
+
+func TestByteOperations(t *testing.T) {
+	r, _ := run(t, New(),
+		0o112702, 0o377, // MOVB #377, R2, sign extended
+		0o012703, 0o1100, // MOV #1100, R3
+		0o112713, 0o125, // MOVB #125, (R3)
+		0o112763, 0o252, 1, // MOVB #252, 1(R3)
+		0o011304, // MOV (R3), R4
+		0o000300, // SWAB R0
+		0,
+	)
+	if r[2] != 0o177777 {
+		t.Errorf("R2 = %o, want 177777", r[2])
+	}
+	if r[4] != 0o125125 {
+		t.Errorf("R4 = %o, want 125125", r[4])
+	}
+}
+
+func TestDivideAndShift(t *testing.T) {
+	r, psw := run(t, New(),
+		0o005000,      // CLR R0
+		0o012701, 100, // MOV #100., R1
+		0o071027, 7, // DIV #7, R0
+		0o012702, 5, // MOV #5, R2
+		0o072227, 3, // ASH #3, R2
+		0o012704, 0o177, // MOV #177, R4
+		0o072427, 0o77, // ASH #-1, R4
+		0,
+	)
+	if r[0] != 14 || r[1] != 2 {
+		t.Errorf("100/7 = %d rem %d, want 14 rem 2", r[0], r[1])
+	}
+	if r[2] != 40 {
+		t.Errorf("5<<3 = %d, want 40", r[2])
+	}
+	if r[4] != 0o77 || psw&flagC == 0 {
+		t.Errorf("177>>1 = %o, C %v, want 77 and C", r[4], psw&flagC != 0)
+	}
+}
+
+func TestSubroutine(t *testing.T) {
+	r, _ := run(t, New(),
+		0o012706, 0o1000, // MOV #1000, SP
+		0o004767, 6, // JSR PC, 1$
+		0o012701, 2, // MOV #2, R1
+		0,           // HALT
+		0o012700, 1, // 1$: MOV #1, R0
+		0o000207, // RTS PC
+	)
+	if r[0] != 1 || r[1] != 2 || r[6] != 0o1000 {
+		t.Errorf("R0 = %o, R1 = %o, SP = %o", r[0], r[1], r[6])
+	}
+}
+
+func TestTerminalOutput(t *testing.T) {
+	var out bytes.Buffer
+	c := New(WithTerminal(&out))
+	load(t, c, 0o1100, 'H'|'I'<<8, '\n')
+	run(t, c,
+		0o012701, 0o1100, // MOV #msg, R1
+		0o112100,           // 1$: MOVB (R1)+, R0
+		0o001406,           // BEQ 3$
+		0o105737, 0o177564, // 2$: TSTB @#177564
+		0o100375,           // BPL 2$
+		0o110037, 0o177566, // MOVB R0, @#177566
+		0o000770, // BR 1$
+		0,        // 3$: HALT
+	)
+	if out.String() != "HI\n" {
+		t.Errorf("output %q, want %q", out.String(), "HI\n")
+	}
+}
+
+func TestTraps(t *testing.T) {
+	c := New()
+	load(t, c, 0o4, 0o3000, 0)     // bus error
+	load(t, c, 0o10, 0o3100, 0)    // reserved instruction
+	load(t, c, 0o30, 0o3200, 0o17) // EMT, with the condition codes set
+	load(t, c, 0o3000, 0o012705, 4, 0)
+	load(t, c, 0o3100, 0o012705, 10, 0)
+	load(t, c, 0o3200, 0o012703, 42, 0o000002) // MOV #42, R3; RTI
+
+	r, psw := run(t, c, 0o012706, 0o1000, 0o104005, 0)
+	if r[3] != 42 || r[6] != 0o1000 || psw != 0 || r[7] != 0o1010 {
+		t.Errorf("EMT: R3 = %o, SP = %o, PSW = %o, PC = %o", r[3], r[6], psw, r[7])
+	}
+	r, _ = run(t, c, 0o012706, 0o1000, 0o005737, 0o170000, 0) // TST @#170000
+	if r[5] != 4 || r[7] != 0o3006 {
+		t.Errorf("bus error: R5 = %o, PC = %o", r[5], r[7])
+	}
+	r, _ = run(t, c, 0o012706, 0o1000, 0o000007, 0)
+	if r[5] != 10 || r[7] != 0o3106 {
+		t.Errorf("reserved instruction: R5 = %o, PC = %o", r[5], r[7])
+	}
+}
+
+func TestSwitchAndDisplayRegisters(t *testing.T) {
+	c := New()
+	c.sr = func() uint16 { return 0o1234 }
+	r, _ := run(t, c,
+		0o013700, 0o177570, // MOV @#177570, R0
+		0o012737, 0o4321, 0o177570, // MOV #4321, @#177570
+		0,
+	)
+	if r[0] != 0o1234 || c.dr != 0o4321 {
+		t.Errorf("SR read %o, DR %o", r[0], c.dr)
+	}
+}
+
+// Returns a tape block loading the data at the address.
+func ldaBlock(addr uint16, data ...byte) []byte {
+	count := 6 + len(data)
+	block := append([]byte{1, 0, byte(count), byte(count >> 8), byte(addr), byte(addr >> 8)}, data...)
+	sum := byte(0)
+	for _, b := range block {
+		sum += b
+	}
+	return append(block, -sum)
+}
+
+func TestLoadLDA(t *testing.T) {
+	var tape []byte
+	tape = append(tape, 0, 0, 0) // leader
+	tape = append(tape, ldaBlock(0o1000, 0o01, 0o02, 0o03, 0o04)...)
+	tape = append(tape, 0)
+	tape = append(tape, ldaBlock(0o2001, 0o377)...)
+	tape = append(tape, ldaBlock(0o1000)...)
+	c := New()
+	start, err := c.LoadLDA(bytes.NewReader(tape))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if start != 0o1000 {
+		t.Errorf("start %o, want 1000", start)
+	}
+	for addr, want := range map[uint32]uint16{0o1000: 0o1001, 0o1002: 0o2003, 0o2000: 0o177400} {
+		if got, _ := c.Read(addr); got != want {
+			t.Errorf("word at %o = %o, want %o", addr, got, want)
+		}
+	}
+}
+
+func TestLoadLDAErrors(t *testing.T) {
+	bad := ldaBlock(0o1000, 1, 2)
+	bad[len(bad)-1]++
+	for _, tc := range []struct {
+		name string
+		tape []byte
+		err  string
+	}{
+		{"checksum", append(bad, ldaBlock(1)...), "bad checksum"},
+		{"no end block", ldaBlock(0o1000, 1, 2), "missing end block"},
+		{"truncated", ldaBlock(0o1000, 1, 2)[:5], "truncated"},
+		{"I/O page", ldaBlock(0o160000, 1, 2), "outside of memory"},
+	} {
+		_, err := New().LoadLDA(bytes.NewReader(tc.tape))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
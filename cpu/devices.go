@@ -0,0 +1,140 @@
+package cpu
+
+import "io"
+
+// I/O page registers
+const (
+	regRCSR = 0o177560
+	regRBUF = 0o177562
+	regXCSR = 0o177564
+	regXBUF = 0o177566
+	regSR   = 0o177570 // switch register when read, display register when written
+	regPSW  = 0o177776
+)
+
+func (c *CPU) ioRead(addr uint16, peek bool) (uint16, bool) {
+	switch addr {
+	case regSR:
+		return c.sr(), true
+	case regPSW:
+		return c.psw, true
+	case regRCSR:
+		return c.tty.rcsr, true
+	case regRBUF:
+		if !peek {
+			c.tty.rcsr &^= csrDone
+		}
+		return uint16(c.tty.rbuf), true
+	case regXCSR:
+		return c.tty.xcsr, true
+	case regXBUF:
+		return 0, true
+	}
+	return 0, false
+}
+
+func (c *CPU) ioWrite(addr, val uint16) bool {
+	switch addr {
+	case regSR:
+		c.dr = val
+	case regPSW:
+		// The T bit can only be set by traps and RTI/RTT
+		c.psw = val&^flagT | c.psw&flagT
+	case regRCSR:
+		c.tty.setRCSR(val)
+	case regRBUF:
+	case regXCSR:
+		c.tty.setXCSR(val)
+	case regXBUF:
+		c.tty.output(byte(val))
+	default:
+		return false
+	}
+	return true
+}
+
+// DL11 serial line, used as the console terminal
+const (
+	dl11Priority = 4
+	vecRCV       = 0o60
+	vecXMT       = 0o64
+	csrDone      = 0o200 // also READY for the transmitter
+	csrIE        = 0o100
+	xmtSteps     = 10 // instructions for transmitting a character
+)
+
+type dl11 struct {
+	out        io.Writer
+	rcsr, xcsr uint16
+	rbuf       byte
+	xmtBusy    int // instructions until the transmitter is ready
+	rcvIntr    bool
+	xmtIntr    bool
+}
+
+func (tty *dl11) reset() {
+	tty.rcsr = 0
+	tty.xcsr = csrDone
+	tty.xmtBusy = 0
+	tty.rcvIntr, tty.xmtIntr = false, false
+}
+
+func (tty *dl11) input(b byte) {
+	tty.rbuf = b
+	tty.rcsr |= csrDone
+	tty.rcvIntr = tty.rcsr&csrIE != 0
+}
+
+func (tty *dl11) output(b byte) {
+	if tty.out != nil {
+		tty.out.Write([]byte{b})
+	}
+	tty.xcsr &^= csrDone
+	tty.xmtBusy = xmtSteps
+	tty.xmtIntr = false
+}
+
+// Called before each instruction.
+func (tty *dl11) tick() {
+	if tty.xmtBusy == 0 {
+		return
+	}
+	tty.xmtBusy--
+	if tty.xmtBusy == 0 {
+		tty.xcsr |= csrDone
+		tty.xmtIntr = tty.xcsr&csrIE != 0
+	}
+}
+
+// An interrupt is requested when IE is set while DONE/READY is.
+func (tty *dl11) setRCSR(val uint16) {
+	if val&csrIE != 0 && tty.rcsr&(csrIE|csrDone) == csrDone {
+		tty.rcvIntr = true
+	}
+	tty.rcsr = tty.rcsr&^csrIE | val&csrIE
+	if tty.rcsr&csrIE == 0 {
+		tty.rcvIntr = false
+	}
+}
+
+func (tty *dl11) setXCSR(val uint16) {
+	if val&csrIE != 0 && tty.xcsr&(csrIE|csrDone) == csrDone {
+		tty.xmtIntr = true
+	}
+	tty.xcsr = tty.xcsr&^csrIE | val&csrIE
+	if tty.xcsr&csrIE == 0 {
+		tty.xmtIntr = false
+	}
+}
+
+func (tty *dl11) interrupt() (uint16, bool) {
+	switch {
+	case tty.rcvIntr:
+		tty.rcvIntr = false
+		return vecRCV, true
+	case tty.xmtIntr:
+		tty.xmtIntr = false
+		return vecXMT, true
+	}
+	return 0, false
+}
@@ -0,0 +1,474 @@
+package cpu
+
+// An operand: a register for mode 0, otherwise an address.
+type operand struct {
+	reg  int // -1 if not a register
+	addr uint16
+}
+
+// Computes the operand for the 6-bit mode and register spec.
+func (c *CPU) operand(spec uint16, isByte bool) operand {
+	reg := int(spec & 7)
+	inc := uint16(2)
+	if isByte && reg < 6 {
+		inc = 1
+	}
+	switch spec >> 3 & 7 {
+	case 0:
+		return operand{reg: reg}
+	case 1:
+		return operand{reg: -1, addr: c.r[reg]}
+	case 2:
+		addr := c.r[reg]
+		c.r[reg] += inc
+		return operand{reg: -1, addr: addr}
+	case 3:
+		addr := c.r[reg]
+		c.r[reg] += 2
+		return operand{reg: -1, addr: c.read16(addr)}
+	case 4:
+		c.r[reg] -= inc
+		return operand{reg: -1, addr: c.r[reg]}
+	case 5:
+		c.r[reg] -= 2
+		return operand{reg: -1, addr: c.read16(c.r[reg])}
+	case 6:
+		x := c.fetch()
+		return operand{reg: -1, addr: x + c.r[reg]}
+	default:
+		x := c.fetch()
+		return operand{reg: -1, addr: c.read16(x + c.r[reg])}
+	}
+}
+
+func (c *CPU) load(op operand, isByte bool) uint16 {
+	switch {
+	case op.reg >= 0 && isByte:
+		return c.r[op.reg] & 0xff
+	case op.reg >= 0:
+		return c.r[op.reg]
+	case isByte:
+		return c.read8(op.addr)
+	default:
+		return c.read16(op.addr)
+	}
+}
+
+func (c *CPU) store(op operand, val uint16, isByte bool) {
+	switch {
+	case op.reg >= 0 && isByte:
+		c.r[op.reg] = c.r[op.reg]&0xff00 | val&0xff
+	case op.reg >= 0:
+		c.r[op.reg] = val
+	case isByte:
+		c.write8(op.addr, val)
+	default:
+		c.write16(op.addr, val)
+	}
+}
+
+// Returns the address of an operand which must not be a register, as for
+// JMP and JSR.
+func (c *CPU) address(spec uint16) uint16 {
+	op := c.operand(spec, false)
+	if op.reg >= 0 {
+		panic(exception{vecBus})
+	}
+	return op.addr
+}
+
+func signBit(isByte bool) uint16 {
+	if isByte {
+		return 0x80
+	}
+	return 0x8000
+}
+
+func valueMask(isByte bool) uint16 {
+	if isByte {
+		return 0xff
+	}
+	return 0xffff
+}
+
+// Sets N and Z from the value, and V and C.
+func (c *CPU) setCC(val uint16, isByte bool, v, carry bool) {
+	c.psw &^= flagN | flagZ | flagV | flagC
+	if val&signBit(isByte) != 0 {
+		c.psw |= flagN
+	}
+	if val&valueMask(isByte) == 0 {
+		c.psw |= flagZ
+	}
+	if v {
+		c.psw |= flagV
+	}
+	if carry {
+		c.psw |= flagC
+	}
+}
+
+func (c *CPU) flag(f uint16) bool {
+	return c.psw&f != 0
+}
+
+// Executes the instruction, returning true if the trace trap must not
+// follow it, as for RTT.
+func (c *CPU) execute(ins uint16) bool {
+	isByte := ins&0x8000 != 0
+	srcSpec, dstSpec := ins>>6&0o77, ins&0o77
+	sign, mask := signBit(isByte), valueMask(isByte)
+	switch ins >> 12 & 7 {
+	case 1: // MOV
+		val := c.load(c.operand(srcSpec, isByte), isByte)
+		op := c.operand(dstSpec, isByte)
+		if isByte && op.reg >= 0 {
+			c.r[op.reg] = uint16(int16(int8(val)))
+		} else {
+			c.store(op, val, isByte)
+		}
+		c.setCC(val, isByte, false, c.flag(flagC))
+	case 2: // CMP
+		src := c.load(c.operand(srcSpec, isByte), isByte)
+		dst := c.load(c.operand(dstSpec, isByte), isByte)
+		res := (src - dst) & mask
+		c.setCC(res, isByte, (src^dst)&(src^res)&sign != 0, src < dst)
+	case 3: // BIT
+		src := c.load(c.operand(srcSpec, isByte), isByte)
+		dst := c.load(c.operand(dstSpec, isByte), isByte)
+		c.setCC(src&dst, isByte, false, c.flag(flagC))
+	case 4: // BIC
+		src := c.load(c.operand(srcSpec, isByte), isByte)
+		op := c.operand(dstSpec, isByte)
+		res := c.load(op, isByte) &^ src
+		c.store(op, res, isByte)
+		c.setCC(res, isByte, false, c.flag(flagC))
+	case 5: // BIS
+		src := c.load(c.operand(srcSpec, isByte), isByte)
+		op := c.operand(dstSpec, isByte)
+		res := c.load(op, isByte) | src
+		c.store(op, res, isByte)
+		c.setCC(res, isByte, false, c.flag(flagC))
+	case 6: // ADD, SUB
+		src := c.load(c.operand(srcSpec, false), false)
+		op := c.operand(dstSpec, false)
+		dst := c.load(op, false)
+		if isByte {
+			res := dst - src
+			c.store(op, res, false)
+			c.setCC(res, false, (src^dst)&(dst^res)&0x8000 != 0, dst < src)
+		} else {
+			res := dst + src
+			c.store(op, res, false)
+			c.setCC(res, false, ^(src^dst)&(src^res)&0x8000 != 0, res < src)
+		}
+	case 7:
+		if isByte {
+			panic(exception{vecReserved}) // floating point
+		}
+		c.executeEIS(ins)
+	default:
+		return c.executeOther(ins)
+	}
+	return false
+}
+
+// MUL, DIV, ASH, ASHC, XOR and SOB.
+func (c *CPU) executeEIS(ins uint16) {
+	reg := int(ins >> 6 & 7)
+	spec := ins & 0o77
+	switch ins >> 9 & 7 {
+	case 0: // MUL
+		res := int32(int16(c.r[reg])) * int32(int16(c.load(c.operand(spec, false), false)))
+		c.r[reg] = uint16(res >> 16)
+		c.r[reg|1] = uint16(res)
+		c.setCC(0, false, false, res < -0x8000 || res > 0x7fff)
+		c.setNZ32(res)
+	case 1: // DIV
+		divisor := int32(int16(c.load(c.operand(spec, false), false)))
+		dividend := int32(uint32(c.r[reg])<<16 | uint32(c.r[reg|1]))
+		if divisor == 0 {
+			c.psw |= flagV | flagC
+			return
+		}
+		quot, rem := dividend/divisor, dividend%divisor
+		if quot < -0x8000 || quot > 0x7fff {
+			c.psw = c.psw&^flagC | flagV
+			return
+		}
+		c.r[reg] = uint16(quot)
+		c.r[reg|1] = uint16(rem)
+		c.setCC(uint16(quot), false, false, false)
+	case 2: // ASH
+		shift := int(int8(c.load(c.operand(spec, false), false)<<2) >> 2)
+		val := int32(int16(c.r[reg]))
+		res, carry := shift32(val, shift, 16)
+		c.r[reg] = uint16(res)
+		c.setCC(uint16(res), false, (int32(int16(res))^val) < 0, carry)
+	case 3: // ASHC
+		shift := int(int8(c.load(c.operand(spec, false), false)<<2) >> 2)
+		val := int32(uint32(c.r[reg])<<16 | uint32(c.r[reg|1]))
+		res, carry := shift32(val, shift, 32)
+		if reg&1 == 0 {
+			c.r[reg] = uint16(res >> 16)
+		}
+		c.r[reg|1] = uint16(res)
+		c.setCC(0, false, (res^val) < 0, carry)
+		c.setNZ32(res)
+	case 4: // XOR
+		op := c.operand(spec, false)
+		res := c.load(op, false) ^ c.r[reg]
+		c.store(op, res, false)
+		c.setCC(res, false, false, c.flag(flagC))
+	case 7: // SOB
+		c.r[reg]--
+		if c.r[reg] != 0 {
+			c.r[7] -= 2 * (ins & 0o77)
+		}
+	default:
+		panic(exception{vecReserved})
+	}
+}
+
+// Shifts a signed value of the given number of bits left, or right if
+// the shift is negative, returning the last bit shifted out.
+func shift32(val int32, shift, bits int) (int32, bool) {
+	switch {
+	case shift > 0:
+		carry := val<<(shift-1)&(1<<(bits-1)) != 0
+		return val << shift, carry
+	case shift < 0:
+		carry := val>>(-shift-1)&1 != 0
+		return val >> -shift, carry
+	}
+	return val, false
+}
+
+func (c *CPU) setNZ32(val int32) {
+	c.psw &^= flagN | flagZ
+	if val < 0 {
+		c.psw |= flagN
+	}
+	if val == 0 {
+		c.psw |= flagZ
+	}
+}
+
+// The instructions with 0 in bits 14-12.
+func (c *CPU) executeOther(ins uint16) bool {
+	isByte := ins&0x8000 != 0
+	switch {
+	case ins&0o074000 == 0 && ins&0o177400 != 0: // 000400-003777, 100000-103777
+		c.branch(ins)
+	case ins >= 0o104000 && ins <= 0o104377:
+		c.trap(vecEMT)
+	case ins >= 0o104400 && ins <= 0o104777:
+		c.trap(vecTRAP)
+	case ins&0o177000 == 0o004000: // JSR
+		reg := int(ins >> 6 & 7)
+		addr := c.address(ins & 0o77)
+		c.push(c.r[reg])
+		c.r[reg] = c.r[7]
+		c.r[7] = addr
+	case ins&0o077700 >= 0o005000 && ins&0o077700 <= 0o006300:
+		c.executeSingle(ins, isByte)
+	case ins&0o177700 == 0o000100: // JMP
+		c.r[7] = c.address(ins & 0o77)
+	case ins&0o177700 == 0o000300: // SWAB
+		op := c.operand(ins&0o77, false)
+		val := c.load(op, false)
+		res := val<<8 | val>>8
+		c.store(op, res, false)
+		c.setCC(res, true, false, false)
+	case ins&0o177700 == 0o006400: // MARK
+		c.r[6] = c.r[7] + 2*(ins&0o77)
+		c.r[7] = c.r[5]
+		c.r[5] = c.pop()
+	case ins&0o077700 == 0o006500: // MFPI, MFPD
+		val := c.load(c.operand(ins&0o77, false), false)
+		c.push(val)
+		c.setCC(val, false, false, c.flag(flagC))
+	case ins&0o077700 == 0o006600: // MTPI, MTPD
+		op := c.operand(ins&0o77, false)
+		val := c.pop()
+		c.store(op, val, false)
+		c.setCC(val, false, false, c.flag(flagC))
+	case ins&0o177700 == 0o006700: // SXT
+		var val uint16
+		if c.flag(flagN) {
+			val = 0xffff
+		}
+		c.store(c.operand(ins&0o77, false), val, false)
+		c.setCC(val, false, false, c.flag(flagC))
+	case ins&0o177700 == 0o106400: // MTPS
+		val := c.load(c.operand(ins&0o77, true), true)
+		c.psw = c.psw&0xff10 | val&0xef
+	case ins&0o177700 == 0o106700: // MFPS
+		val := c.psw & 0xff
+		op := c.operand(ins&0o77, true)
+		if op.reg >= 0 {
+			c.r[op.reg] = uint16(int16(int8(val)))
+		} else {
+			c.store(op, val, true)
+		}
+		c.setCC(val, true, false, c.flag(flagC))
+	case ins&0o177770 == 0o000200: // RTS
+		reg := int(ins & 7)
+		c.r[7] = c.r[reg]
+		c.r[reg] = c.pop()
+	case ins&0o177770 == 0o000230: // SPL
+		if c.kernel() {
+			c.psw = c.psw&^0o340 | (ins&7)<<5
+		}
+	case ins&0o177740 == 0o000240: // condition codes
+		if ins&0o20 != 0 {
+			c.psw |= ins & 0o17
+		} else {
+			c.psw &^= ins & 0o17
+		}
+	default:
+		return c.executeSpecial(ins)
+	}
+	return false
+}
+
+func (c *CPU) branch(ins uint16) {
+	n, z, v, carry := c.flag(flagN), c.flag(flagZ), c.flag(flagV), c.flag(flagC)
+	var taken bool
+	switch ins & 0o177400 {
+	case 0o000400: // BR
+		taken = true
+	case 0o001000: // BNE
+		taken = !z
+	case 0o001400: // BEQ
+		taken = z
+	case 0o002000: // BGE
+		taken = n == v
+	case 0o002400: // BLT
+		taken = n != v
+	case 0o003000: // BGT
+		taken = !z && n == v
+	case 0o003400: // BLE
+		taken = z || n != v
+	case 0o100000: // BPL
+		taken = !n
+	case 0o100400: // BMI
+		taken = n
+	case 0o101000: // BHI
+		taken = !carry && !z
+	case 0o101400: // BLOS
+		taken = carry || z
+	case 0o102000: // BVC
+		taken = !v
+	case 0o102400: // BVS
+		taken = v
+	case 0o103000: // BCC
+		taken = !carry
+	case 0o103400: // BCS
+		taken = carry
+	}
+	if taken {
+		c.r[7] += uint16(int16(int8(ins)) * 2)
+	}
+}
+
+// CLR, COM, INC, DEC, NEG, ADC, SBC, TST, ROR, ROL, ASR, ASL.
+func (c *CPU) executeSingle(ins uint16, isByte bool) {
+	sign, mask := signBit(isByte), valueMask(isByte)
+	op := c.operand(ins&0o77, isByte)
+	var val uint16
+	if ins&0o077700 != 0o005000 { // CLR doesn't read
+		val = c.load(op, isByte)
+	}
+	carryIn := c.flag(flagC)
+	var res uint16
+	var v, carry bool
+	switch ins & 0o077700 {
+	case 0o005000: // CLR
+		res = 0
+	case 0o005100: // COM
+		res = ^val & mask
+		carry = true
+	case 0o005200: // INC
+		res = (val + 1) & mask
+		v, carry = res == sign, carryIn
+	case 0o005300: // DEC
+		res = (val - 1) & mask
+		v, carry = val == sign, carryIn
+	case 0o005400: // NEG
+		res = -val & mask
+		v, carry = res == sign, res != 0
+	case 0o005500: // ADC
+		res = val
+		if carryIn {
+			res = (val + 1) & mask
+		}
+		v, carry = carryIn && val == sign-1, carryIn && val == mask
+	case 0o005600: // SBC
+		res = val
+		if carryIn {
+			res = (val - 1) & mask
+		}
+		v, carry = carryIn && val == sign, carryIn && val == 0
+	case 0o005700: // TST
+		c.setCC(val, isByte, false, false)
+		return
+	case 0o006000: // ROR
+		res = val >> 1
+		if carryIn {
+			res |= sign
+		}
+		carry = val&1 != 0
+		v = (res&sign != 0) != carry
+	case 0o006100: // ROL
+		res = val << 1 & mask
+		if carryIn {
+			res |= 1
+		}
+		carry = val&sign != 0
+		v = (res&sign != 0) != carry
+	case 0o006200: // ASR
+		res = val>>1 | val&sign
+		carry = val&1 != 0
+		v = (res&sign != 0) != carry
+	case 0o006300: // ASL
+		res = val << 1 & mask
+		carry = val&sign != 0
+		v = (res&sign != 0) != carry
+	}
+	c.store(op, res, isByte)
+	c.setCC(res, isByte, v, carry)
+}
+
+// HALT, WAIT, RTI, BPT, IOT, RESET, RTT.
+func (c *CPU) executeSpecial(ins uint16) bool {
+	switch ins {
+	case 0: // HALT
+		if !c.kernel() {
+			panic(exception{vecBus})
+		}
+		c.halted = true
+	case 1: // WAIT
+		c.waiting = true
+	case 2, 6: // RTI, RTT
+		pc := c.pop()
+		psw := c.pop()
+		if !c.kernel() {
+			// Can't lower the mode nor change the priority
+			psw = psw&^0o340 | c.psw&0o340 | c.psw&0o170000
+		}
+		c.r[7], c.psw = pc, psw
+		return ins == 6
+	case 3: // BPT
+		c.trap(vecBPT)
+	case 4: // IOT
+		c.trap(vecIOT)
+	case 5: // RESET
+		if c.kernel() {
+			c.tty.reset()
+		}
+	default:
+		panic(exception{vecReserved})
+	}
+	return false
+}
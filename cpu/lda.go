@@ -0,0 +1,80 @@
+package cpu
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Loads an absolute loader paper tape image into memory, returning the
+// start address from the tape, which is odd if the tape doesn't give one.
+func (c *CPU) LoadLDA(r io.Reader) (uint16, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	br := bufio.NewReader(r)
+	for {
+		count, addr, data, err := readLDABlock(br)
+		if err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			return addr, nil
+		}
+		for i, b := range data {
+			a := addr + uint16(i)
+			if a >= ioPage {
+				return 0, fmt.Errorf("lda: address %o outside of memory", a)
+			}
+			c.busWrite(a, uint16(b), true)
+		}
+	}
+}
+
+// Reads the next block: the 001 000 header, the little-endian byte count
+// including the header and the load address, the data and a checksum
+// making the sum of all the bytes zero.
+func readLDABlock(br *bufio.Reader) (int, uint16, []byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			return 0, 0, nil, errors.New("lda: missing end block")
+		} else if err != nil {
+			return 0, 0, nil, err
+		}
+		if b != 1 {
+			continue // leader
+		}
+		if b, err = br.ReadByte(); err != nil {
+			return 0, 0, nil, fmt.Errorf("lda: truncated block: %w", err)
+		}
+		if b == 0 {
+			break
+		}
+		br.UnreadByte()
+	}
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, 0, nil, fmt.Errorf("lda: truncated block: %w", err)
+	}
+	count := int(header[0]) | int(header[1])<<8
+	addr := uint16(header[2]) | uint16(header[3])<<8
+	if count < 6 {
+		return 0, 0, nil, fmt.Errorf("lda: invalid byte count %d", count)
+	}
+	data := make([]byte, count-6+1) // with the checksum
+	if _, err := io.ReadFull(br, data); err != nil {
+		return 0, 0, nil, fmt.Errorf("lda: truncated block: %w", err)
+	}
+	sum := byte(1)
+	for _, b := range header {
+		sum += b
+	}
+	for _, b := range data {
+		sum += b
+	}
+	if sum != 0 {
+		return 0, 0, nil, fmt.Errorf("lda: bad checksum for block at %o", addr)
+	}
+	return count - 6, addr, data[:count-6], nil
+}
@@ -0,0 +1,216 @@
+package cpu
+
+import (
+	"context"
+	"time"
+
+	"github.com/perpen/pidp11"
+	"github.com/perpen/pidp11/console"
+)
+
+// Interval between the executions of batches of instructions and the
+// updates of the leds.
+const tickInterval = 20 * time.Millisecond
+
+// Operates the CPU from the panel until the context is done or the panel
+// stops:
+//   - START with ENABLE initialises the devices and runs from the loaded
+//     address, with HALT it only initialises.
+//   - CONT resumes, or with HALT executes a single instruction. S_BUS_CYCLE
+//     is handled as S_INST.
+//   - HALT stops the CPU, the address leds then showing the PC.
+//   - LOAD ADRS, EXAM and DEP operate the memory while the CPU is halted.
+//
+// While running, the address and data leds show the bus activity, or the
+// data leds show the display register if selected with the data knob,
+// see pidp11.WithKnobSelectors().
+func (c *CPU) Run(ctx context.Context, panel *pidp11.Panel) error {
+	c.mu.Lock()
+	c.sr = func() uint16 { return uint16(panel.ReadRegSwitches()) }
+	pc := c.r[7]
+	c.mu.Unlock()
+	sub := panel.Subscribe(pidp11.SubscribeOptions{
+		IDs: []pidp11.SwitchID{
+			pidp11.SS_LOAD, pidp11.SS_EXAM, pidp11.SS_DEP,
+			pidp11.SS_START, pidp11.SS_CONT,
+		},
+		Kinds: []pidp11.EventKind{pidp11.KindChange},
+	})
+	defer sub.Close()
+	f := &front{
+		cpu:   c,
+		panel: panel,
+		cons:  console.New(panel, c),
+		fx:    pidp11.NewSimpleEffect(0, 0),
+	}
+	f.cons.Load(uint32(pc))
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case evt, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			if evt.On {
+				f.press(evt.ID)
+			}
+		case <-ticker.C:
+			f.tick()
+		}
+	}
+}
+
+// The state of the panel while operating the CPU.
+type front struct {
+	cpu      *CPU
+	panel    *pidp11.Panel
+	cons     *console.Console
+	fx       pidp11.Effect
+	running  bool
+	samples  int
+	addrBits [16]int // number of samples with each bit set
+	dataBits [16]int
+}
+
+// The console switches are ignored while running.
+func (f *front) press(id pidp11.SwitchID) {
+	if f.running {
+		return
+	}
+	c := f.cpu
+	halt := f.panel.SwitchState(pidp11.SS_HALT)
+	switch id {
+	case pidp11.SS_LOAD:
+		f.cons.Load(uint32(f.panel.ReadRegSwitches()))
+	case pidp11.SS_EXAM:
+		f.cons.Exam()
+	case pidp11.SS_DEP:
+		f.cons.Deposit(uint16(f.panel.ReadRegSwitches()))
+	case pidp11.SS_START:
+		c.Reset()
+		if !halt {
+			c.SetPC(uint16(f.cons.Address()))
+			f.start()
+		}
+	case pidp11.SS_CONT:
+		if !halt {
+			f.start()
+			return
+		}
+		c.mu.Lock()
+		c.halted = false
+		c.step()
+		c.mu.Unlock()
+		f.halt()
+	}
+}
+
+func (f *front) start() {
+	f.cpu.mu.Lock()
+	f.cpu.halted = false
+	f.cpu.mu.Unlock()
+	f.running = true
+	f.panel.ShowAddress(0, pidp11.Addr16, f.fx)
+}
+
+func (f *front) halt() {
+	c := f.cpu
+	c.mu.Lock()
+	c.halted = true
+	pc, psw := c.r[7], c.psw
+	c.mu.Unlock()
+	f.running = false
+	f.showStatus(false, psw)
+	f.cons.Load(uint32(pc))
+}
+
+// Executes the instructions for one tick, sampling the bus activity.
+func (f *front) tick() {
+	if !f.running {
+		return
+	}
+	if f.panel.SwitchState(pidp11.SS_HALT) {
+		f.halt()
+		return
+	}
+	c := f.cpu
+	c.mu.Lock()
+	n := int(int64(c.ips) * int64(tickInterval) / int64(time.Second))
+	for range n {
+		c.step()
+		if c.halted {
+			break
+		}
+		if !c.waiting {
+			f.sample(c.busAddr, c.busData)
+		}
+	}
+	halted, waiting, psw, dr := c.halted, c.waiting, c.psw, c.dr
+	c.mu.Unlock()
+	if halted {
+		f.halt()
+		return
+	}
+	f.showBus(dr)
+	f.showStatus(!waiting, psw)
+}
+
+func (f *front) sample(addr, data uint16) {
+	f.samples++
+	for bit := range 16 {
+		if addr&(1<<bit) != 0 {
+			f.addrBits[bit]++
+		}
+		if data&(1<<bit) != 0 {
+			f.dataBits[bit]++
+		}
+	}
+}
+
+// Shows each bit of the bus with a brightness proportional to the time it
+// was set.
+func (f *front) showBus(dr uint16) {
+	if f.panel.DataSelection() == pidp11.LED_DISPLAY_REGISTER {
+		f.panel.ShowData(dr, f.fx)
+	}
+	if f.samples == 0 {
+		return
+	}
+	frame := pidp11.NewFrame()
+	for bit := range 16 {
+		frame.Led(pidp11.LED_A0+pidp11.LedID(bit), float64(f.addrBits[bit])/float64(f.samples), f.fx)
+	}
+	if f.panel.DataSelection() != pidp11.LED_DISPLAY_REGISTER {
+		for bit := range 16 {
+			frame.Led(pidp11.LED_D0+pidp11.LedID(bit), float64(f.dataBits[bit])/float64(f.samples), f.fx)
+		}
+		frame.Led(pidp11.LED_PAR_LO, 0, f.fx)
+		frame.Led(pidp11.LED_PAR_HI, 0, f.fx)
+	}
+	f.panel.Commit(frame)
+	f.samples = 0
+	f.addrBits = [16]int{}
+	f.dataBits = [16]int{}
+}
+
+// Shows RUN, PAUSE, MASTER and the mode of the CPU.
+func (f *front) showStatus(active bool, psw uint16) {
+	mode := psw >> 14
+	f.led(pidp11.LED_RUN, f.running && active)
+	f.led(pidp11.LED_PAUSE, f.running && !active)
+	f.led(pidp11.LED_MASTER, f.running)
+	f.led(pidp11.LED_KERNEL, mode == 0)
+	f.led(pidp11.LED_SUPER, mode == 1)
+	f.led(pidp11.LED_USER, mode == 3)
+}
+
+func (f *front) led(id pidp11.LedID, on bool) {
+	if on {
+		f.panel.Led(id, 1, f.fx)
+	} else {
+		f.panel.Led(id, 0, f.fx)
+	}
+}
@@ -0,0 +1,85 @@
+package daemon
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Connection to the daemon.
+type Client struct {
+	conn    net.Conn
+	scanner *bufio.Scanner
+}
+
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{conn: conn, scanner: bufio.NewScanner(conn)}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Sends the request, and returns the value of the "ok" reply, or the
+// message of an "err" reply as an error.
+func (c *Client) Command(line string) (string, error) {
+	if _, err := fmt.Fprintln(c.conn, line); err != nil {
+		return "", err
+	}
+	reply, err := c.readLine()
+	if err != nil {
+		return "", err
+	}
+	if msg, ok := strings.CutPrefix(reply, "err "); ok {
+		return "", errors.New(msg)
+	}
+	if reply == "ok" {
+		return "", nil
+	}
+	if val, ok := strings.CutPrefix(reply, "ok "); ok {
+		return val, nil
+	}
+	return "", fmt.Errorf("invalid reply: %q", reply)
+}
+
+// Subscribes to the events, and calls fn with each of them until the
+// connection is closed or fn returns false. The events are given as
+// returned by Event.String(), or in JSON.
+func (c *Client) Events(asJSON bool, fn func(string) bool) error {
+	line := "subscribe"
+	if asJSON {
+		line += " json"
+	}
+	if _, err := c.Command(line); err != nil {
+		return err
+	}
+	for {
+		reply, err := c.readLine()
+		if err != nil {
+			return err
+		}
+		evt, ok := strings.CutPrefix(reply, "event ")
+		if !ok {
+			return fmt.Errorf("invalid event: %q", reply)
+		}
+		if !fn(evt) {
+			return nil
+		}
+	}
+}
+
+func (c *Client) readLine() (string, error) {
+	if !c.scanner.Scan() {
+		if err := c.scanner.Err(); err != nil {
+			return "", err
+		}
+		return "", errors.New("connection closed")
+	}
+	return c.scanner.Text(), nil
+}
@@ -0,0 +1,276 @@
+// Package daemon shares the panel between processes, through a line-based
+// protocol on a Unix socket.
+//
+// Each request is a line of space-separated words, answered by "ok",
+// followed by a value for some requests, or "err <message>":
+//
+//	led <name> <brightness> [<effect> [<param>...]]   eg "led A3 1 flash 0.2"
+//	claim <name>...                  own the leds until disconnecting
+//	clear [<offMs>]                  switches off the leds not claimed by other clients
+//	brightness [<adjust>]            answers the adjust, after setting it if given
+//	sr                               answers the value of the switch register, in octal
+//	subscribe [json]                 the connection then only receives "event <event>" lines
+//
+// The effects are given as for pidp11.ParseEffect(), "simple" by default,
+// with their params in [0, 1].
+// The leds claimed by a client can't be set by the others, and are
+// switched off when it disconnects.
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/perpen/pidp11"
+)
+
+type Server struct {
+	panel  *pidp11.Panel
+	logger *slog.Logger
+	mu     sync.Mutex
+	owners map[pidp11.LedID]*client
+}
+
+type client struct {
+	conn net.Conn
+}
+
+func NewServer(panel *pidp11.Panel, logger *slog.Logger) *Server {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Server{
+		panel:  panel,
+		logger: logger,
+		owners: map[pidp11.LedID]*client{},
+	}
+}
+
+// Accepts connections until the context is done or the listener fails.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		go s.serveConn(ctx, &client{conn: conn})
+	}
+}
+
+func (s *Server) serveConn(ctx context.Context, c *client) {
+	defer s.release(c)
+	defer c.conn.Close()
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		words := strings.Fields(scanner.Text())
+		if len(words) == 0 {
+			continue
+		}
+		if words[0] == "subscribe" {
+			s.subscribe(ctx, c, words[1:])
+			return
+		}
+		reply := "ok"
+		if val, err := s.handle(c, words); err != nil {
+			reply = "err " + err.Error()
+		} else if val != "" {
+			reply += " " + val
+		}
+		if _, err := fmt.Fprintln(c.conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+var errUsage = errors.New("invalid arguments")
+
+func (s *Server) handle(c *client, words []string) (string, error) {
+	args := words[1:]
+	switch words[0] {
+	case "led":
+		return "", s.setLed(c, args)
+	case "claim":
+		return "", s.claim(c, args)
+	case "clear":
+		offMs := 0
+		if len(args) > 1 {
+			return "", errUsage
+		}
+		if len(args) == 1 {
+			var err error
+			if offMs, err = strconv.Atoi(args[0]); err != nil {
+				return "", errUsage
+			}
+		}
+		if offMs < 0 {
+			return "", errUsage
+		}
+		s.clear(c, offMs)
+		return "", nil
+	case "brightness":
+		if len(args) > 1 {
+			return "", errUsage
+		}
+		if len(args) == 1 {
+			adjust, err := strconv.ParseFloat(args[0], 64)
+			if err != nil || !(adjust >= 0 && adjust <= 1) {
+				return "", errors.New("adjust must be in [0, 1]")
+			}
+			s.panel.SetBrightnessAdjust(adjust)
+		}
+		return strconv.FormatFloat(s.panel.GetBrightnessAdjust(), 'g', -1, 64), nil
+	case "sr":
+		return strconv.FormatUint(uint64(s.panel.ReadRegSwitches()), 8), nil
+	}
+	return "", fmt.Errorf("unknown request: %s", words[0])
+}
+
+func (s *Server) setLed(c *client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	id, ok := pidp11.LookupLed(args[0])
+	if !ok {
+		return fmt.Errorf("unknown led: %s", args[0])
+	}
+	brightness, err := strconv.ParseFloat(args[1], 64)
+	if err != nil || !(brightness >= 0 && brightness <= 1) {
+		return errors.New("brightness must be in [0, 1]")
+	}
+	spec := "simple"
+	if len(args) > 2 {
+		spec = args[2]
+	}
+	fx, count, err := pidp11.ParseEffect(spec)
+	if err != nil {
+		return err
+	}
+	var params []float64
+	for _, arg := range args[min(len(args), 3):] {
+		param, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return fmt.Errorf("invalid param: %s", arg)
+		}
+		params = append(params, param)
+	}
+	if len(params) != count {
+		return fmt.Errorf("effect %s takes %d params", spec, count)
+	}
+	if err := pidp11.CheckParams(params...); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if owner, ok := s.owners[id]; ok && owner != c {
+		return fmt.Errorf("led %s claimed by another client", args[0])
+	}
+	s.panel.Led(id, brightness, fx, params...)
+	return nil
+}
+
+func (s *Server) claim(c *client, names []string) error {
+	ids := make([]pidp11.LedID, len(names))
+	for i, name := range names {
+		id, ok := pidp11.LookupLed(name)
+		if !ok {
+			return fmt.Errorf("unknown led: %s", name)
+		}
+		ids[i] = id
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, id := range ids {
+		if owner, ok := s.owners[id]; ok && owner != c {
+			return fmt.Errorf("led %s claimed by another client", names[i])
+		}
+	}
+	for _, id := range ids {
+		s.owners[id] = c
+	}
+	return nil
+}
+
+// Switches off the leds, except the ones claimed by other clients.
+func (s *Server) clear(c *client, offMs int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keep []pidp11.LedID
+	for id, owner := range s.owners {
+		if owner != c {
+			keep = append(keep, id)
+		}
+	}
+	s.panel.ClearLedsExcept(offMs, keep)
+}
+
+// Switches off the leds claimed by the client.
+func (s *Server) release(c *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, owner := range s.owners {
+		if owner == c {
+			delete(s.owners, id)
+			s.panel.Led(id, 0, pidp11.NewSimpleEffect(0, 0))
+		}
+	}
+}
+
+func (s *Server) subscribe(ctx context.Context, c *client, args []string) {
+	asJSON := len(args) == 1 && args[0] == "json"
+	if len(args) > 1 || len(args) == 1 && !asJSON {
+		fmt.Fprintln(c.conn, "err", errUsage)
+		return
+	}
+	sub := s.panel.Subscribe(pidp11.SubscribeOptions{})
+	defer sub.Close()
+	if _, err := fmt.Fprintln(c.conn, "ok"); err != nil {
+		return
+	}
+	// Detect the disconnection of the client
+	closed := make(chan struct{})
+	go func() {
+		bufio.NewReader(c.conn).WriteTo(discard{})
+		close(closed)
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-closed:
+			return
+		case evt, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			line := evt.String()
+			if asJSON {
+				data, _ := json.Marshal(evt)
+				line = string(data)
+			}
+			if _, err := fmt.Fprintln(c.conn, "event", line); err != nil {
+				return
+			}
+		}
+	}
+}
+
+type discard struct{}
+
+func (discard) Write(b []byte) (int, error) {
+	return len(b), nil
+}
@@ -0,0 +1,138 @@
+package daemon
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+// Serves the panel on a socket, returning its path.
+func serve(t *testing.T, panel *pidp11.Panel) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pidpd.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewServer(panel, slog.New(slog.NewTextHandler(io.Discard, nil))).Serve(ctx, l)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return path
+}
+
+func dial(t *testing.T, path string) *Client {
+	t.Helper()
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func brightness(panel *pidp11.Panel, id pidp11.LedID) float64 {
+	return panel.CaptureScene().Led(id).Brightness
+}
+
+func TestInvalidRequests(t *testing.T) {
+	panel := pidp11.NewPanel()
+	c := dial(t, serve(t, panel))
+	for _, line := range []string{
+		"led A3 NaN",
+		"led A3 Inf",
+		"led A3 1.5",
+		"led A3 -0.1",
+		"led A3 1 flash NaN",
+		"led A3 1 flash 2",
+		"led A3 1 flash -1",
+		"led A3 1 flash",
+		"led A3 1 flash:-1,0 0.5",
+		"led A3 1 sparkle",
+		"led NOPE 1",
+		"brightness NaN",
+		"brightness 2",
+		"clear -1",
+		"clear x",
+		"nope",
+	} {
+		if _, err := c.Command(line); err == nil {
+			t.Errorf("%q: no error", line)
+		}
+	}
+	// The connection is still usable
+	if _, err := c.Command("led A3 1 flash:100,100 0.5"); err != nil {
+		t.Fatal(err)
+	}
+	if b := brightness(panel, pidp11.LED_A3); b != 1 {
+		t.Errorf("A3 brightness %v", b)
+	}
+	if val, err := c.Command("brightness 0.5"); err != nil || val != "0.5" {
+		t.Errorf("brightness %q, err %v", val, err)
+	}
+}
+
+func TestClaims(t *testing.T) {
+	panel := pidp11.NewPanel()
+	path := serve(t, panel)
+	a, b := dial(t, path), dial(t, path)
+
+	for _, line := range []string{"claim A3 A4", "led A3 1", "led A4 1"} {
+		if _, err := a.Command(line); err != nil {
+			t.Fatalf("%q: %v", line, err)
+		}
+	}
+	if _, err := b.Command("led A3 0"); err == nil || !strings.Contains(err.Error(), "claimed") {
+		t.Errorf("led claimed by another client: %v", err)
+	}
+	if _, err := b.Command("claim A4"); err == nil {
+		t.Error("claimed a led claimed by another client")
+	}
+	if _, err := b.Command("led A5 1"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Clearing leaves the leds claimed by the other clients
+	if _, err := b.Command("clear"); err != nil {
+		t.Fatal(err)
+	}
+	if brightness(panel, pidp11.LED_A3) != 1 || brightness(panel, pidp11.LED_A5) != 0 {
+		t.Errorf("after clear: A3 %v, A5 %v", brightness(panel, pidp11.LED_A3), brightness(panel, pidp11.LED_A5))
+	}
+	if _, err := a.Command("clear"); err != nil {
+		t.Fatal(err)
+	}
+	if brightness(panel, pidp11.LED_A3) != 0 {
+		t.Error("A3 not cleared by its owner")
+	}
+
+	// The leds are released when the owner disconnects
+	if _, err := a.Command("led A4 1"); err != nil {
+		t.Fatal(err)
+	}
+	a.Close()
+	c := dial(t, path)
+	deadline := time.Now().Add(time.Second)
+	for _, err := c.Command("claim A4"); err != nil; _, err = c.Command("claim A4") {
+		if time.Now().After(deadline) {
+			t.Fatal("A4 not released")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if brightness(panel, pidp11.LED_A4) != 0 {
+		t.Error("A4 still lit after its owner disconnected")
+	}
+}
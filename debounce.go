@@ -0,0 +1,48 @@
+package pidp11
+
+import "time"
+
+// Filters out the bounces of the switches: a new reading is accepted
+// once it has been stable for the settle time of the switch.
+type debouncer struct {
+	settle [38]time.Duration // per nativeSwitchID
+	raw    [38]bool          // last reading
+	since  [38]time.Time     // when the reading last changed
+}
+
+func (d *debouncer) setSettleTimes(toggle, momentary time.Duration) {
+	for nid := range d.settle {
+		if isToggle(nativeSwitchID(nid)) {
+			d.settle[nid] = toggle
+		} else {
+			d.settle[nid] = momentary
+		}
+	}
+}
+
+// Returns true if the reading has been stable for long enough.
+func (d *debouncer) settled(nid nativeSwitchID, reading bool, now time.Time) bool {
+	if reading != d.raw[nid] {
+		d.raw[nid] = reading
+		d.since[nid] = now
+		return d.settle[nid] == 0
+	}
+	return now.Sub(d.since[nid]) >= d.settle[nid]
+}
+
+// Takes the reading as stable, for the initial state of the switch.
+func (d *debouncer) seed(nid nativeSwitchID, reading bool) {
+	d.raw[nid] = reading
+	d.since[nid] = time.Time{}
+}
+
+// The knobs contacts are considered as momentary switches.
+func isToggle(nid nativeSwitchID) bool {
+	switch {
+	case nid >= swSR0 && nid <= swSR21:
+		return true
+	case nid == swTEST || nid == swENABLE || nid == swSINST:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package pidp11
+
+import (
+	"context"
+	"time"
+)
+
+// The functions below operate on this panel.
+var defaultPanel = NewPanel()
+
+func DefaultPanel() *Panel {
+	return defaultPanel
+}
+
+// See Panel.Start().
+func Start(ctx context.Context, opts ...Option) error {
+	return defaultPanel.Start(ctx, opts...)
+}
+
+// See Panel.Stop().
+func Stop() error {
+	return defaultPanel.Stop()
+}
+
+// See Panel.Events().
+func Events() <-chan Event {
+	return defaultPanel.Events()
+}
+
+// See Panel.Subscribe().
+func Subscribe(opts SubscribeOptions) *Subscription {
+	return defaultPanel.Subscribe(opts)
+}
+
+// See Panel.RawEvents().
+func RawEvents() <-chan RawEvent {
+	return defaultPanel.RawEvents()
+}
+
+func GetBrightnessAdjust() float64 {
+	return defaultPanel.GetBrightnessAdjust()
+}
+
+// See Panel.SetBrightnessAdjust().
+func SetBrightnessAdjust(adjust float64) {
+	defaultPanel.SetBrightnessAdjust(adjust)
+}
+
+// See Panel.SetBrightnessScaler().
+func SetBrightnessScaler(scaler Scaler) {
+	defaultPanel.SetBrightnessScaler(scaler)
+}
+
+// See Panel.SetFrequencyScaler().
+func SetFrequencyScaler(scaler Scaler) {
+	defaultPanel.SetFrequencyScaler(scaler)
+}
+
+// See Panel.ClearLeds().
+func ClearLeds(offMs int) {
+	defaultPanel.ClearLeds(offMs)
+}
+
+// See Panel.ClearLedsExcept().
+func ClearLedsExcept(offMs int, keep []LedID) {
+	defaultPanel.ClearLedsExcept(offMs, keep)
+}
+
+// See Panel.Led().
+func Led(id LedID, brightP float64, fx Effect, fxParams ...float64) {
+	defaultPanel.Led(id, brightP, fx, fxParams...)
+}
+
+// See Panel.Brightness().
+func Brightness(id LedID) float64 {
+	return defaultPanel.Brightness(id)
+}
+
+// See Panel.LoopDuration().
+func LoopDuration() time.Duration {
+	return defaultPanel.LoopDuration()
+}
+
+// See Panel.ReadRegSwitches().
+func ReadRegSwitches() uint {
+	return defaultPanel.ReadRegSwitches()
+}
+
+// See Panel.AddChord().
+func AddChord(chord Chord) {
+	defaultPanel.AddChord(chord)
+}
+
+// See Panel.AddSequence().
+func AddSequence(seq Sequence) {
+	defaultPanel.AddSequence(seq)
+}
+
+// See Panel.RemoveGesture().
+func RemoveGesture(name string) {
+	defaultPanel.RemoveGesture(name)
+}
+
+// See Panel.SwitchState().
+func SwitchState(id SwitchID) bool {
+	return defaultPanel.SwitchState(id)
+}
+
+// See Panel.Snapshot().
+func GetSnapshot() Snapshot {
+	return defaultPanel.Snapshot()
+}
+
+// See Panel.Commit().
+func Commit(f *Frame) {
+	defaultPanel.Commit(f)
+}
+
+// See Panel.CaptureScene().
+func CaptureScene() *Scene {
+	return defaultPanel.CaptureScene()
+}
+
+// See Panel.ShowScene().
+func ShowScene(ctx context.Context, s *Scene, t Transition) error {
+	return defaultPanel.ShowScene(ctx, s, t)
+}
+
+// See Panel.ShowAddress().
+func ShowAddress(val uint, width AddressWidth, fx Effect, fxParams ...float64) {
+	defaultPanel.ShowAddress(val, width, fx, fxParams...)
+}
+
+// See Panel.ShowData().
+func ShowData(val uint16, fx Effect, fxParams ...float64) {
+	defaultPanel.ShowData(val, fx, fxParams...)
+}
+
+// See Panel.AddressSelection().
+func AddressSelection() LedID {
+	return defaultPanel.AddressSelection()
+}
+
+// See Panel.DataSelection().
+func DataSelection() LedID {
+	return defaultPanel.DataSelection()
+}
@@ -0,0 +1,78 @@
+package pidp11
+
+// Width of the addresses shown by ShowAddress(), lighting the
+// corresponding ADDRESSING indicator.
+type AddressWidth int
+
+const (
+	Addr16 AddressWidth = 16
+	Addr18 AddressWidth = 18
+	Addr22 AddressWidth = 22
+)
+
+var addressWidthLeds = map[AddressWidth]LedID{
+	Addr16: LED_ADDR_16,
+	Addr18: LED_ADDR_18,
+	Addr22: LED_ADDR_22,
+}
+
+// Shows the value on the address leds A0..A21 using the given effect, and
+// lights the indicator for the address width. The bits above the width are ignored.
+// The leds are updated at once, see Commit().
+func (p *Panel) ShowAddress(val uint, width AddressWidth, fx Effect, fxParams ...float64) {
+	f := NewFrame()
+	f.ShowAddress(val, width, fx, fxParams...)
+	p.Commit(f)
+}
+
+// Shows the value on the data leds D0..D15 using the given effect, and
+// the parity of each byte on PAR_LO and PAR_HI.
+// As on the 11/70, which uses odd parity, a parity led is on if its byte
+// has an even number of bits set.
+// The leds are updated at once, see Commit().
+func (p *Panel) ShowData(val uint16, fx Effect, fxParams ...float64) {
+	f := NewFrame()
+	f.ShowData(val, fx, fxParams...)
+	p.Commit(f)
+}
+
+// Sets the address leds in the frame, see Panel.ShowAddress().
+func (f *Frame) ShowAddress(val uint, width AddressWidth, fx Effect, fxParams ...float64) {
+	_, ok := addressWidthLeds[width]
+	assert(ok, "invalid address width: %d", width)
+	val &= 1<<width - 1
+	f.showBits(LED_A0, 22, val, fx, fxParams...)
+	for w, id := range addressWidthLeds {
+		f.showBit(id, w == width, fx, fxParams...)
+	}
+}
+
+// Sets the data leds in the frame, see Panel.ShowData().
+func (f *Frame) ShowData(val uint16, fx Effect, fxParams ...float64) {
+	f.showBits(LED_D0, 16, uint(val), fx, fxParams...)
+	f.showBit(LED_PAR_LO, parityBit(uint8(val)), fx, fxParams...)
+	f.showBit(LED_PAR_HI, parityBit(uint8(val>>8)), fx, fxParams...)
+}
+
+func (f *Frame) showBits(first LedID, count int, val uint, fx Effect, fxParams ...float64) {
+	for i := range count {
+		f.showBit(first+LedID(i), val&(1<<i) != 0, fx, fxParams...)
+	}
+}
+
+func (f *Frame) showBit(id LedID, on bool, fx Effect, fxParams ...float64) {
+	if on {
+		f.Led(id, 1, fx, fxParams...)
+	} else {
+		f.Led(id, 0, fx, fxParams...)
+	}
+}
+
+// Returns the odd parity bit of the byte.
+func parityBit(b uint8) bool {
+	ones := 0
+	for ; b != 0; b &= b - 1 {
+		ones++
+	}
+	return ones%2 == 0
+}
@@ -1,11 +1,20 @@
 package pidp11
 
 import (
+	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
+// Makes the brightness envelope of a led when it is set with Led(), see
+// Envelope. The brightness is the [0, 1] value requested, after scaling,
+// and the params are those passed to Led(). The effect may panic if the
+// params are invalid.
+// MakeEnvelope() is called with the led locked, and the Envelope is only
+// valid during the call, see Envelope.
 type Effect interface {
-	makeEnvelope(spec *ledSpec, bright int, fxParams ...float64)
+	MakeEnvelope(env *Envelope, bright float64, fxParams ...float64)
 }
 
 // One-shot attack or release, onMs used when switching on, offMs when off.
@@ -21,18 +30,17 @@ func NewSimpleEffect(onMs, offMs int) SimpleEffect {
 	}
 }
 
-func (fx SimpleEffect) makeEnvelope(spec *ledSpec, bright int, fxParams ...float64) {
+func (fx SimpleEffect) MakeEnvelope(env *Envelope, bright float64, fxParams ...float64) {
 	assertParams(0, fxParams)
-	env := &spec.env
-	delta := abs(bright - spec.bright)
+	current := env.Current()
 	var fxMs int
 	if bright == 0 {
 		fxMs = fx.offMs
 	} else {
 		fxMs = fx.onMs
 	}
-	ms := scale(delta, 31, 0, fxMs)
-	env.addStage(spec.bright, bright, ms, true)
+	ms := int(math.Round(math.Abs(bright-current) * float64(fxMs)))
+	env.AddStage(current, bright, ms, true)
 }
 
 // Periodic strobing, the led stays on for a fixed amount of time
@@ -55,17 +63,17 @@ func NewStrobeEffect(onMs, offMs int) StrobeEffect {
 	}
 }
 
-func (fx StrobeEffect) makeEnvelope(spec *ledSpec, bright int, fxParams ...float64) {
+func (fx StrobeEffect) MakeEnvelope(env *Envelope, bright float64, fxParams ...float64) {
 	assertParams(1, fxParams)
-	hz := frequencyScaler.Scale(fxParams[0])
+	hz := env.Frequency(fxParams[0])
 	onMs := fx.onMs
 	offMs := fx.offMs
 	if hz == 0 {
-		spec.env.addStage(spec.bright, 0, offMs, true)
+		env.AddStage(env.Current(), 0, offMs, true)
 		return
 	}
 	periodMs := int(math.Round(1e3 / hz))
-	strobeOnMs := loopμs * fx.strobeOnLoops / 1e3
+	strobeOnMs := int(env.Resolution().Microseconds()) * fx.strobeOnLoops / 1e3
 	restMs := periodMs - strobeOnMs
 	assert(restMs >= 0, "restMs=%d", restMs)
 	if onMs+offMs > restMs {
@@ -77,7 +85,7 @@ func (fx StrobeEffect) makeEnvelope(spec *ledSpec, bright int, fxParams ...float
 	}
 	upMs := onMs + strobeOnMs
 	downMs := periodMs - upMs
-	spec.setupASRS(bright, bright/fx.lowDivider, onMs, offMs, upMs, downMs)
+	env.setupASRS(bright, bright/float64(fx.lowDivider), onMs, offMs, upMs, downMs)
 }
 
 // Periodic flashing, the led stays on and off for the same amount of time.
@@ -96,13 +104,13 @@ func NewFlashEffect(onMs, offMs int) FlashEffect {
 	}
 }
 
-func (fx FlashEffect) makeEnvelope(spec *ledSpec, bright int, fxParams ...float64) {
+func (fx FlashEffect) MakeEnvelope(env *Envelope, bright float64, fxParams ...float64) {
 	assertParams(1, fxParams)
-	hz := frequencyScaler.Scale(fxParams[0])
+	hz := env.Frequency(fxParams[0])
 	onMs := fx.onMs
 	offMs := fx.offMs
 	if hz == 0 {
-		spec.env.addStage(spec.bright, 0, offMs, true)
+		env.AddStage(env.Current(), 0, offMs, true)
 		return
 	}
 	periodMs := int(math.Round(1e3 / hz))
@@ -115,21 +123,20 @@ func (fx FlashEffect) makeEnvelope(spec *ledSpec, bright int, fxParams ...float6
 	if onMs > upMs {
 		onMs = upMs
 	}
-	spec.setupASRS(bright, bright/fx.lowDivider, onMs, offMs, upMs, downMs)
+	env.setupASRS(bright, bright/float64(fx.lowDivider), onMs, offMs, upMs, downMs)
 }
 
 // Create an attack-sustain-release-sustain envelope
-func (spec *ledSpec) setupASRS(hi, lo, onMs, offMs, upMs, downMs int) {
-	logger.Debug("setupASRS", "led", spec.name, "onMs", onMs, "offMs", offMs, "upMs", upMs, "downMs", downMs)
-	env := &spec.env
+func (env *Envelope) setupASRS(hi, lo float64, onMs, offMs, upMs, downMs int) {
+	env.spec.panel.logger.Debug("setupASRS", "led", env.spec.name, "onMs", onMs, "offMs", offMs, "upMs", upMs, "downMs", downMs)
 	if onMs > 0 {
-		env.addStage(lo, hi, onMs, false) // attack
+		env.AddStage(lo, hi, onMs, false) // attack
 	}
-	env.addStage(hi, hi, upMs-onMs, false) // sustain high
+	env.AddStage(hi, hi, upMs-onMs, false) // sustain high
 	if offMs > 0 {
-		env.addStage(hi, lo, offMs, false) // release
+		env.AddStage(hi, lo, offMs, false) // release
 	}
-	env.addStage(lo, lo, downMs-offMs, false) //sustain low
+	env.AddStage(lo, lo, downMs-offMs, false) //sustain low
 }
 
 // Periodic, recognisable pulsating envelope.
@@ -140,14 +147,78 @@ func NewErrorEffect() ErrorEffect {
 	return ErrorEffect{}
 }
 
-func (fx ErrorEffect) makeEnvelope(spec *ledSpec, bright int, fxParams ...float64) {
+func (fx ErrorEffect) MakeEnvelope(env *Envelope, bright float64, fxParams ...float64) {
 	assertParams(0, fxParams)
 	hi := bright
 	ms := 200
 	lo := hi / 4
-	spec.env.addStage(hi, 0, ms, false)
-	spec.env.addStage(0, lo, ms, false)
-	spec.env.addStage(lo, lo, ms, false)
+	env.AddStage(hi, 0, ms, false)
+	env.AddStage(0, lo, ms, false)
+	env.AddStage(lo, lo, ms, false)
+}
+
+// Creates an effect from its name, "simple", "flash", "strobe" or "error",
+// and the arguments of its constructor, eg onMs and offMs, which can't be
+// negative. Also returns the number of parameters the effect requires when passed to Led().
+func NewEffectByName(name string, args ...int) (Effect, int, error) {
+	onMs, offMs := 0, 0
+	for _, arg := range args {
+		if arg < 0 {
+			return nil, 0, fmt.Errorf("effect arguments must be >= 0, got %d", arg)
+		}
+	}
+	switch name {
+	case "simple", "flash", "strobe":
+		if len(args) != 0 && len(args) != 2 {
+			return nil, 0, fmt.Errorf("effect %s takes 0 or 2 arguments, got %d", name, len(args))
+		}
+		if len(args) == 2 {
+			onMs, offMs = args[0], args[1]
+		}
+	case "error":
+		if len(args) != 0 {
+			return nil, 0, fmt.Errorf("effect error takes no arguments, got %d", len(args))
+		}
+	}
+	switch name {
+	case "simple":
+		return NewSimpleEffect(onMs, offMs), 0, nil
+	case "flash":
+		return NewFlashEffect(onMs, offMs), 1, nil
+	case "strobe":
+		return NewStrobeEffect(onMs, offMs), 1, nil
+	case "error":
+		return NewErrorEffect(), 0, nil
+	}
+	return nil, 0, fmt.Errorf("unknown effect: %s", name)
+}
+
+// Parses an effect given by its name optionally followed by the arguments
+// of its constructor, eg "flash" or "flash:250,250", see NewEffectByName().
+func ParseEffect(spec string) (Effect, int, error) {
+	name, argsSpec, hasArgs := strings.Cut(spec, ":")
+	var args []int
+	if hasArgs {
+		for _, arg := range strings.Split(argsSpec, ",") {
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid effect argument: %q", arg)
+			}
+			args = append(args, n)
+		}
+	}
+	return NewEffectByName(name, args...)
+}
+
+// Returns an error unless the parameters are in [0, 1], as required by
+// the effects created by NewEffectByName().
+func CheckParams(params ...float64) error {
+	for _, param := range params {
+		if !(param >= 0 && param <= 1) {
+			return fmt.Errorf("effect params must be in [0, 1], got %v", param)
+		}
+	}
+	return nil
 }
 
 func assertParams(count int, params []float64) {
@@ -3,6 +3,7 @@ package pidp11
 import (
 	"fmt"
 	"math"
+	"time"
 )
 
 // A stage describes a linear progression between 2 brightness levels
@@ -21,33 +22,35 @@ func (s stage) String() string {
 
 // The envelope describes the evolution of brightness as a sequence of stages
 type envelope struct {
-	stages   [4]stage // increase size if you create a longer envelope
-	offset   int      // in the current stage, in loops
-	stageNum int      // index of the current stage in the stages array
-	count    int      // number of stages
+	stages   []stage
+	offset   int // in the current stage, in loops
+	stageNum int // index of the current stage in the stages array
+	loop     int // index of the stage following the last one, if periodic
 }
 
 func (env *envelope) String() string {
-	return fmt.Sprintf("envelope[stages=%v offset=%d index=%d count=%d]",
-		env.stages[:env.count], env.offset, env.stageNum, env.count)
+	return fmt.Sprintf("envelope[stages=%v offset=%d index=%d loop=%d]",
+		env.stages, env.offset, env.stageNum, env.loop)
 }
 
 // Clear all stages, reset offset
 func (env *envelope) reset() {
+	env.stages = env.stages[:0]
 	env.offset = 0
 	env.stageNum = 0
-	env.count = 0
+	env.loop = 0
 }
 
+// An envelope is periodic unless it ends with a final stage.
 func (env *envelope) isPeriodic() bool {
-	// xxx assumes all one-shot envelopes have only 1 stage
-	return env.count > 1
+	return len(env.stages) > 0 && !env.stages[len(env.stages)-1].final
 }
 
-func (env *envelope) addStage(bright1, bright2, ms int, isFinal bool) {
-	logger.Debug("addStage", "start", bright1, "end", bright2, "durationMs", ms, "final", isFinal)
-	assert(env.count < len(env.stages), "too many stages on envelope %v", env)
-	loops := msToLoops(ms)
+// Appends a stage to the led envelope
+func (spec *ledSpec) addStage(bright1, bright2, ms int, isFinal bool) {
+	spec.panel.logger.Debug("addStage", "start", bright1, "end", bright2, "durationMs", ms, "final", isFinal)
+	env := &spec.env
+	loops := spec.panel.msToLoops(ms)
 	stepLoops := 0
 	if bright1 != bright2 {
 		delta := abs(bright1 - bright2)
@@ -59,30 +62,36 @@ func (env *envelope) addStage(bright1, bright2, ms int, isFinal bool) {
 			bright1 = bright2
 		}
 	}
-	env.stages[env.count] = stage{
+	env.stages = append(env.stages, stage{
 		loops:     loops,
 		start:     bright1,
 		end:       bright2,
 		stepLoops: stepLoops,
 		final:     isFinal,
-	}
-	env.count++
+	})
 }
 
 func (spec *ledSpec) makeEnvelope(brightP float64, fx Effect, fxParams ...float64) {
 	env := &spec.env
 	env.reset()
-	bright := int(math.Round(brightP * (brightnessSteps - 1)))
-	fx.makeEnvelope(spec, bright, fxParams...)
+	bright := brightnessStep(brightP)
+	fx.MakeEnvelope(&spec.builder, steppedBrightness(bright), fxParams...)
+	for i, s := range env.stages {
+		if s.final {
+			// The stages after the first final one are never reached
+			env.stages = env.stages[:i+1]
+			break
+		}
+	}
+	assert(env.loop < len(env.stages) || env.loop == 0,
+		"loop point %d beyond last stage %d", env.loop, len(env.stages)-1)
 }
 
-// Advance by one step through the envelope and set brightness
+// Advance by one step through the envelope and set brightness.
+// Must be called with the led locked.
 func (spec *ledSpec) step() {
-	spec.Lock()
-	defer spec.Unlock()
-
 	env := &spec.env
-	if env.count == 0 { // fixed brightness
+	if len(env.stages) == 0 { // fixed brightness
 		return
 	}
 	stage := env.stages[env.stageNum]
@@ -90,11 +99,14 @@ func (spec *ledSpec) step() {
 		if stage.final {
 			// Remove stage and remain forever on current brightness
 			spec.bright = stage.end
-			env.count = 0
+			env.stages = env.stages[:0]
 			env.stageNum = 0
 		} else {
 			// Move to the next stage
-			env.stageNum = (env.stageNum + 1) % env.count
+			env.stageNum++
+			if env.stageNum == len(env.stages) {
+				env.stageNum = env.loop
+			}
 			env.offset = 0
 			spec.bright = env.stages[env.stageNum].start
 		}
@@ -124,7 +136,7 @@ func (spec *ledSpec) getProgress() float64 {
 	}
 	totalLoops := 0
 	totalOffset := 0
-	for i := 0; i < env.count; i++ {
+	for i := range env.stages {
 		stageLoops := env.stages[i].loops
 		switch {
 		case i < env.stageNum:
@@ -134,25 +146,30 @@ func (spec *ledSpec) getProgress() float64 {
 		}
 		totalLoops += stageLoops
 	}
+	if totalLoops == 0 {
+		return 0
+	}
 	return float64(totalOffset) / float64(totalLoops)
 }
 
 // Set the envelope's stage, offset, set corresponding brigthness
 func (spec *ledSpec) setProgress(pct float64) {
 	env := &spec.env
+	if len(env.stages) == 0 {
+		return
+	}
 	if !env.isPeriodic() {
 		spec.bright = env.stages[0].start
 		return
 	}
 	totalLoops := 0
-	for i := 0; i < env.count; i++ {
-		stageLoops := env.stages[i].loops
-		totalLoops += stageLoops
+	for i := range env.stages {
+		totalLoops += env.stages[i].loops
 	}
 	loops := int(math.Round(pct * float64(totalLoops)))
 	sofar := 0
 	var stage, offset, bright int
-	for i := 0; i < env.count; i++ {
+	for i := range env.stages {
 		s := &env.stages[i]
 		if loops < sofar+s.loops {
 			stage = i
@@ -167,8 +184,71 @@ func (spec *ledSpec) setProgress(pct float64) {
 	spec.bright = bright
 }
 
-func msToLoops(ms int) int {
-	return int(math.Round(float64(ms) * 1000 / float64(loopμs)))
+// Builder of the brightness envelope of a led, passed to
+// Effect.MakeEnvelope(). The brightness levels are [0, 1] values, after
+// scaling, rounded to the 32 levels supported.
+// The envelope is a sequence of stages, each a linear progression between
+// two levels. It ends with its first final stage, the led then staying at
+// the end level of that stage. Otherwise it is periodic: after the last
+// stage it continues at the loop point, by default the first stage.
+//
+// The led is locked while the envelope is built, so the effect must not
+// call the methods of the Panel operating on the leds, eg Led(),
+// Brightness() or Commit(), which would deadlock. The Envelope is reused
+// for the next changes of the led, and must not be kept after
+// MakeEnvelope() returns.
+type Envelope struct {
+	spec *ledSpec
+}
+
+// Returns the current brightness of the led, for starting the envelope
+// from it and avoiding a jump in brightness.
+func (env *Envelope) Current() float64 {
+	return steppedBrightness(env.spec.bright)
+}
+
+// Appends a stage going from the start to the end brightness over the
+// duration. A change that can't be done gradually over the duration
+// happens immediately.
+// The levels are clamped to [0, 1], NaN being taken as 0, and a negative
+// duration as 0, so that an effect can't break the envelope.
+func (env *Envelope) AddStage(start, end float64, ms int, final bool) {
+	env.spec.addStage(brightnessStep(start), brightnessStep(end), max(ms, 0), final)
+}
+
+// Sets the stage at which a periodic envelope continues after its last
+// stage, eg 1 to loop after an initial attack stage.
+func (env *Envelope) Loop(stage int) {
+	assert(stage >= 0, "invalid loop point: %d", stage)
+	env.spec.env.loop = stage
+}
+
+// Returns the frequency for the [0, 1] param, see SetFrequencyScaler().
+func (env *Envelope) Frequency(param float64) float64 {
+	return env.spec.panel.scaleFrequency(param)
+}
+
+// Returns the approximate duration of a refresh of the leds, the
+// resolution of the envelopes.
+func (env *Envelope) Resolution() time.Duration {
+	return time.Duration(env.spec.panel.loopDurationμs()) * time.Microsecond
+}
+
+// Returns the level of the brightness, clamped to [0, 1].
+func brightnessStep(bright float64) int {
+	if math.IsNaN(bright) {
+		return 0
+	}
+	bright = min(max(bright, 0), 1)
+	return int(math.Round(bright * (brightnessSteps - 1)))
+}
+
+func steppedBrightness(step int) float64 {
+	return float64(step) / (brightnessSteps - 1)
+}
+
+func (p *Panel) msToLoops(ms int) int {
+	return int(math.Round(float64(ms) * 1000 / float64(p.loopDurationμs())))
 }
 
 func abs(x int) int {
@@ -0,0 +1,55 @@
+package pidp11
+
+// Desired state of a set of leds, switched to at once by Commit(), so
+// that the main loop never displays a partially updated value.
+// The zero value is an empty frame.
+type Frame struct {
+	leds []frameLed
+}
+
+type frameLed struct {
+	id    LedID
+	state LedState
+	via   Effect // if not nil, makes the envelope instead of the effect of the state
+}
+
+func NewFrame() *Frame {
+	return &Frame{}
+}
+
+// Sets the state of the led in the frame, as Panel.Led() would.
+// Setting the same led again overrides its previous state.
+func (f *Frame) Led(id LedID, brightP float64, fx Effect, fxParams ...float64) {
+	f.leds = append(f.leds, frameLed{
+		id:    id,
+		state: LedState{brightP, fx, cloneParams(fxParams)},
+	})
+}
+
+// Empties the frame, for reusing it.
+func (f *Frame) Reset() {
+	f.leds = f.leds[:0]
+}
+
+// Sets the state of all the leds of the frame, between two refresh
+// passes of the main loop. As with Led(), the progress through the
+// envelope of each led is preserved.
+func (p *Panel) Commit(f *Frame) {
+	p.logger.Debug("Commit", "leds", len(f.leds))
+	brightPs := make([]float64, len(f.leds))
+	p.mu.Lock()
+	for i, led := range f.leds {
+		brightPs[i] = p.brightnessScaler.Scale(led.state.Brightness) * p.brightnessAdjust
+	}
+	p.mu.Unlock()
+	p.frameMu.Lock()
+	defer p.frameMu.Unlock()
+	for i, led := range f.leds {
+		spec := &p.ledSpecs[led.id]
+		if led.via != nil {
+			spec.set(brightPs[i], led.state, led.via)
+		} else {
+			spec.set(brightPs[i], led.state, led.state.Effect, led.state.Params...)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package pidp11
+
+import "time"
+
+type EventKind int
+
+const (
+	KindChange      EventKind = iota // switch moved, or momentary switch pressed
+	KindRelease                      // momentary switch released
+	KindLongPress                    // momentary switch held for a while
+	KindRepeat                       // momentary switch still held
+	KindDoublePress                  // momentary switch pressed twice quickly
+	KindChord                        // see Chord
+	KindSequence                     // see Sequence
+	KindRegister                     // register switches settled on a new value
+	KindSelect                       // knob selector moved, see WithKnobSelectors()
+)
+
+var eventKindNames = []string{
+	"change",
+	"release",
+	"long-press",
+	"repeat",
+	"double-press",
+	"chord",
+	"sequence",
+	"register",
+	"select",
+}
+
+func (kind EventKind) String() string {
+	return eventKindNames[kind]
+}
+
+// Configuration of the gestures detected on the momentary switches
+// (LOAD, EXAM, DEP, CONT, START and the knobs pushes).
+// The durations set to 0 disable the corresponding gesture.
+type Gestures struct {
+	Release        bool          // emit KindRelease events
+	LongPress      time.Duration // switch held for this long
+	RepeatDelay    time.Duration // first KindRepeat event after this delay
+	RepeatInterval time.Duration // then every interval while held
+	DoublePress    time.Duration // max delay between the 2 presses
+}
+
+type pressState struct {
+	held       bool
+	pressedAt  time.Time
+	longDone   bool      // KindLongPress emitted for the current press
+	nextRepeat time.Time // when to emit the next KindRepeat event
+}
+
+type gestureTracker struct {
+	cfg     Gestures
+	presses [SS_KNOBA]pressState // indexed by SwitchID
+}
+
+// Returns the events triggered by the press or release of a momentary
+// switch, in addition to the KindChange event emitted for the press.
+func (g *gestureTracker) update(id SwitchID, pressed bool, now time.Time) []Event {
+	ps := &g.presses[id]
+	if !pressed {
+		ps.held = false
+		if g.cfg.Release {
+			return []Event{{ID: id, Kind: KindRelease}}
+		}
+		return nil
+	}
+	var evts []Event
+	if g.cfg.DoublePress > 0 && !ps.pressedAt.IsZero() &&
+		now.Sub(ps.pressedAt) <= g.cfg.DoublePress {
+		evts = append(evts, Event{ID: id, On: true, Kind: KindDoublePress})
+		ps.pressedAt = time.Time{} // a third press is not a double press
+	} else {
+		ps.pressedAt = now
+	}
+	ps.held = true
+	ps.longDone = false
+	delay := g.cfg.RepeatDelay
+	if delay == 0 {
+		delay = g.cfg.RepeatInterval
+	}
+	ps.nextRepeat = now.Add(delay)
+	return evts
+}
+
+// Returns the events for the switches held long enough.
+func (g *gestureTracker) tick(now time.Time) []Event {
+	var evts []Event
+	for id := range g.presses {
+		ps := &g.presses[id]
+		if !ps.held {
+			continue
+		}
+		if g.cfg.LongPress > 0 && !ps.longDone && !ps.pressedAt.IsZero() &&
+			now.Sub(ps.pressedAt) >= g.cfg.LongPress {
+			ps.longDone = true
+			evts = append(evts, Event{ID: SwitchID(id), On: true, Kind: KindLongPress})
+		}
+		if g.cfg.RepeatInterval > 0 && !now.Before(ps.nextRepeat) {
+			ps.nextRepeat = ps.nextRepeat.Add(g.cfg.RepeatInterval)
+			evts = append(evts, Event{ID: SwitchID(id), On: true, Kind: KindRepeat})
+		}
+	}
+	return evts
+}
+
+var momentaryNativeIDs = map[SwitchID]nativeSwitchID{
+	SS_KNOBA_PUSH: swKNOBA_PUSH,
+	SS_KNOBD_PUSH: swKNOBD_PUSH,
+	SS_LOAD:       swLOAD,
+	SS_EXAM:       swEXAM,
+	SS_DEP:        swDEP,
+	SS_CONT:       swCONT,
+	SS_START:      swSTART,
+}
+
+// Returns SS_NIL if not a momentary switch.
+func momentarySwitchID(nid nativeSwitchID) SwitchID {
+	switch nid {
+	case swKNOBA_PUSH:
+		return SS_KNOBA_PUSH
+	case swKNOBD_PUSH:
+		return SS_KNOBD_PUSH
+	case swLOAD:
+		return SS_LOAD
+	case swEXAM:
+		return SS_EXAM
+	case swDEP:
+		return SS_DEP
+	case swCONT:
+		return SS_CONT
+	case swSTART:
+		return SS_START
+	}
+	return SS_NIL
+}
@@ -2,58 +2,115 @@ package pidp11
 
 import (
 	"fmt"
+	"sort"
+	"time"
 )
 
-// The mechanism for detecting knob rotations used in the original C version
-// can be simplified to only check for a sequence of 2 non-consecutive events,
-// instead of a sequence of 4 consecutive events.
+// Each knob has 2 contacts, closing and opening in sequence as the knob is
+// turned. Each knob has its own decoder tracking the state of the contacts.
+// We accumulate the quarter steps of the sequence, and emit a step when a
+// full sequence has been seen. Contact bounces cancel out, and transitions
+// which cannot be decoded (ie missed readings) are ignored.
 
-type knobEvent struct {
-	isCw, state bool
+type knobDecoder struct {
+	contacts int // bit 0 for the anticlockwise contact, bit 1 for the clockwise one
+	quarters int // accumulated quarter steps, positive clockwise
+	position int // accumulated steps, positive clockwise
+	lastStep time.Time
+	lastCw   bool
 }
 
-// First and last events for clockwise/anticlockwise rotation
-var cwStart = knobEvent{true, true}
-var cwEnd = knobEvent{false, false}
-var acwStart = knobEvent{false, true}
-var acwEnd = knobEvent{true, false}
-var end knobEvent
+// Quarter steps for the transitions between contacts states.
+// Clockwise sequence is 0 → 2 → 3 → 1 → 0, ie the clockwise contact
+// closes first.
+var quadrature = [4][4]int{
+	{0, -1, 1, 0},
+	{1, 0, 0, -1},
+	{-1, 0, 0, 1},
+	{0, 1, -1, 0},
+}
+
+// Rotation acceleration: a step coming less than Interval after the
+// previous step in the same direction has its delta multiplied by Factor.
+type KnobAccel struct {
+	Interval time.Duration
+	Factor   int
+}
 
 // For non-knobs, simply returns the event.
 // For knobs returns either:
 //   - an event with ID SS_NIL, meaning the event should be ignored
-//   - or a synthetic event with ID SW_KNOBA or SW_KNOBD, and a state
-//     indicating the direction of the rotation.
-func eventForKnob(nid nativeSwitchID, state bool) Event {
-	var knobID SwitchID
-	var isCw bool
+//   - or a synthetic event with ID SS_KNOBA or SS_KNOBD, a state
+//     indicating the direction of the rotation, and the signed number of
+//     steps, positive clockwise.
+func (p *Panel) eventForKnob(nid nativeSwitchID, state bool, now time.Time) Event {
+	knobID, knob, bit := p.knobContact(nid)
+	if knob == nil {
+		panic(fmt.Errorf("not a knob ID: %d", nid))
+	}
+	contacts := knob.contacts &^ bit
+	if state {
+		contacts |= bit
+	}
+	knob.quarters += quadrature[knob.contacts][contacts]
+	knob.contacts = contacts
+	if knob.quarters > -4 && knob.quarters < 4 {
+		return Event{}
+	}
+	cw := knob.quarters > 0
+	knob.quarters = 0
+	delta := 1
+	if cw == knob.lastCw && !knob.lastStep.IsZero() {
+		elapsed := now.Sub(knob.lastStep)
+		for _, accel := range p.knobAccel {
+			if elapsed < accel.Interval {
+				delta = accel.Factor
+				break
+			}
+		}
+	}
+	knob.lastStep = now
+	knob.lastCw = cw
+	if !cw {
+		delta = -delta
+	}
+	knob.position += delta
+	return Event{ID: knobID, On: cw, Delta: delta}
+}
+
+// Returns the knob and the bit in its contacts state for the native
+// switch, or a nil decoder if the switch is not a knob contact.
+func (p *Panel) knobContact(nid nativeSwitchID) (SwitchID, *knobDecoder, int) {
 	switch nid {
 	case swKNOBA_CW:
-		knobID = SS_KNOBA
-		isCw = true
+		return SS_KNOBA, &p.knobs[0], 2
 	case swKNOBA_ACW:
-		knobID = SS_KNOBA
-		isCw = false
+		return SS_KNOBA, &p.knobs[0], 1
 	case swKNOBD_CW:
-		knobID = SS_KNOBD
-		isCw = true
+		return SS_KNOBD, &p.knobs[1], 2
 	case swKNOBD_ACW:
-		knobID = SS_KNOBD
-		isCw = false
-	default:
-		panic(fmt.Errorf("not a knob ID: %d", nid))
+		return SS_KNOBD, &p.knobs[1], 1
 	}
-	kev := knobEvent{isCw, state}
-	switch kev {
-	case cwStart:
-		end = cwEnd
-		return Event{}
-	case acwStart:
-		end = acwEnd
-		return Event{}
-	case end:
-		return Event{ID: knobID, On: end == cwEnd}
-	default:
-		return Event{}
+	return SS_NIL, nil, 0
+}
+
+// Sets the initial state of the contact, if the switch is a knob contact.
+func (p *Panel) initKnob(nid nativeSwitchID, state bool) {
+	_, knob, bit := p.knobContact(nid)
+	if knob == nil {
+		return
+	}
+	knob.contacts &^= bit
+	if state {
+		knob.contacts |= bit
 	}
+	knob.quarters = 0
+}
+
+func sortKnobAccels(accels []KnobAccel) []KnobAccel {
+	accels = append([]KnobAccel(nil), accels...)
+	sort.Slice(accels, func(i, j int) bool {
+		return accels[i].Interval < accels[j].Interval
+	})
+	return accels
 }
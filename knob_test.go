@@ -0,0 +1,42 @@
+package pidp11
+
+import (
+	"testing"
+	"time"
+)
+
+type contactChange struct {
+	nid    nativeSwitchID
+	closed bool
+}
+
+// Feeds the contact changes to the decoder, returning the sum of the
+// deltas of the events.
+func turn(p *Panel, changes []contactChange) int {
+	delta := 0
+	for _, c := range changes {
+		delta += p.eventForKnob(c.nid, c.closed, time.Time{}).Delta
+	}
+	return delta
+}
+
+func TestKnobDirection(t *testing.T) {
+	type change = contactChange
+	for _, tc := range []struct {
+		name    string
+		changes []change
+		delta   int
+	}{
+		{"A clockwise", []change{{swKNOBA_CW, true}, {swKNOBA_ACW, true}, {swKNOBA_CW, false}, {swKNOBA_ACW, false}}, 1},
+		{"A anticlockwise", []change{{swKNOBA_ACW, true}, {swKNOBA_CW, true}, {swKNOBA_ACW, false}, {swKNOBA_CW, false}}, -1},
+		{"D clockwise", []change{{swKNOBD_CW, true}, {swKNOBD_ACW, true}, {swKNOBD_CW, false}, {swKNOBD_ACW, false}}, 1},
+		{"D anticlockwise", []change{{swKNOBD_ACW, true}, {swKNOBD_CW, true}, {swKNOBD_ACW, false}, {swKNOBD_CW, false}}, -1},
+		{"bounce", []change{{swKNOBA_CW, true}, {swKNOBA_CW, false}, {swKNOBA_CW, true}, {swKNOBA_ACW, true}, {swKNOBA_CW, false}, {swKNOBA_ACW, false}}, 1},
+		{"half turn back", []change{{swKNOBA_CW, true}, {swKNOBA_ACW, true}, {swKNOBA_CW, false}, {swKNOBA_CW, true}, {swKNOBA_ACW, false}, {swKNOBA_CW, false}}, 0},
+	} {
+		delta := turn(NewPanel(), tc.changes)
+		if delta != tc.delta {
+			t.Errorf("%s: delta %d, want %d", tc.name, delta, tc.delta)
+		}
+	}
+}
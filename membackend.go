@@ -0,0 +1,200 @@
+package pidp11
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const gpioPinsCount = 28
+
+// In-memory backend emulating the leds and switches matrix, for running
+// without the hardware, eg in tests.
+// The leds lit during each refresh of a led row are recorded, and the
+// switches can be opened/closed with SetSwitch().
+type MemBackend struct {
+	sync.Mutex
+	modes     [gpioPinsCount]PinMode
+	pulls     [gpioPinsCount]PinPull
+	levels    [gpioPinsCount]bool
+	leds      [ledsCount]bool   // lit during the last refresh of their row
+	litCounts [ledsCount]uint64 // number of refreshes the led was lit
+	refreshes [len(ledRows)]uint64
+	closed    [len(gpioRows)][len(gpioCols)]bool // switches
+}
+
+// All switches are initially in their rest position.
+func NewMemBackend() *MemBackend {
+	b := &MemBackend{}
+	b.SetSwitchByID(SS_TEST, false)
+	return b
+}
+
+func (b *MemBackend) Open() error {
+	return nil
+}
+
+func (b *MemBackend) Close() error {
+	return nil
+}
+
+func (b *MemBackend) Mode(pin uint, mode PinMode) {
+	b.Lock()
+	defer b.Unlock()
+	wasDriven := b.isDrivenHigh(pin)
+	b.modes[pin] = mode
+	b.latchLeds(pin, wasDriven)
+	if row := pinIndex(ledRows[:], pin); row >= 0 && mode == ModeInput {
+		// Released led row, as when the loop exits
+		for colnum := range gpioCols {
+			b.leds[row*len(gpioCols)+colnum] = false
+		}
+	}
+}
+
+func (b *MemBackend) Pull(pin uint, pull PinPull) {
+	b.Lock()
+	defer b.Unlock()
+	b.pulls[pin] = pull
+}
+
+func (b *MemBackend) Write(pin uint, high bool) {
+	b.Lock()
+	defer b.Unlock()
+	wasDriven := b.isDrivenHigh(pin)
+	b.levels[pin] = high
+	b.latchLeds(pin, wasDriven)
+}
+
+func (b *MemBackend) Read(pin uint) bool {
+	b.Lock()
+	defer b.Unlock()
+	if b.modes[pin] == ModeOutput {
+		return b.levels[pin]
+	}
+	col := pinIndex(gpioCols[:], pin)
+	if col >= 0 {
+		// A closed switch connects the column to its row, which pulls
+		// the column low if the row is driven low.
+		for row, rowPin := range gpioRows {
+			if b.closed[row][col] && b.modes[rowPin] == ModeOutput && !b.levels[rowPin] {
+				return false
+			}
+		}
+	}
+	return b.pulls[pin] == PullUp
+}
+
+// Opens or closes the switch at the given position in the matrix,
+// the switch being the nativeSwitchID row*len(gpioCols)+col.
+func (b *MemBackend) SetSwitch(row, col int, closed bool) {
+	assert(row >= 0 && row < len(gpioRows), "invalid switch row: %d", row)
+	assert(col >= 0 && col < len(gpioCols), "invalid switch column: %d", col)
+	b.Lock()
+	defer b.Unlock()
+	b.closed[row][col] = closed
+}
+
+// Sets the position of the switch producing events with the given ID.
+// For the register switches, TEST and the momentary switches, on means
+// up/pressed. The toggles are given by their event IDs, SS_HALT with on
+// for HALT and off for ENABLE, and SS_S_BUS_CYCLE with on for S_BUS_CYCLE
+// and off for S_INST. For the knobs only the push is supported, see
+// TurnKnob().
+func (b *MemBackend) SetSwitchByID(id SwitchID, on bool) {
+	closed := on
+	var nid nativeSwitchID
+	switch {
+	case id >= SS_SR0 && id <= SS_SR21:
+		nid = swSR0 + nativeSwitchID(id-SS_SR0)
+	case id == SS_TEST:
+		nid = swTEST
+		closed = !on // closed in the rest position
+	case id == SS_HALT:
+		nid = swENABLE
+	case id == SS_S_BUS_CYCLE:
+		nid = swSINST
+	default:
+		var ok bool
+		nid, ok = momentaryNativeIDs[id]
+		if !ok {
+			panic(fmt.Errorf("unsupported switch: %s", switchNames[id]))
+		}
+	}
+	b.setNativeSwitch(nid, closed)
+}
+
+// Turns the knob SS_KNOBA or SS_KNOBD by one notch, by actioning its
+// contacts in sequence, the contact of the direction closing first. The interval between the contact changes must be
+// long enough for the main loop to read each of them.
+func (b *MemBackend) TurnKnob(id SwitchID, cw bool, interval time.Duration) {
+	var first, second nativeSwitchID
+	switch id {
+	case SS_KNOBA:
+		first, second = swKNOBA_CW, swKNOBA_ACW
+	case SS_KNOBD:
+		first, second = swKNOBD_CW, swKNOBD_ACW
+	default:
+		panic(fmt.Errorf("not a knob: %s", switchNames[id]))
+	}
+	if !cw {
+		first, second = second, first
+	}
+	for _, step := range []struct {
+		nid    nativeSwitchID
+		closed bool
+	}{{first, true}, {second, true}, {first, false}, {second, false}} {
+		b.setNativeSwitch(step.nid, step.closed)
+		time.Sleep(interval)
+	}
+}
+
+func (b *MemBackend) setNativeSwitch(nid nativeSwitchID, closed bool) {
+	b.SetSwitch(int(nid)/len(gpioCols), int(nid)%len(gpioCols), closed)
+}
+
+// Returns true if the led was lit during the last refresh of its row.
+func (b *MemBackend) Led(id LedID) bool {
+	b.Lock()
+	defer b.Unlock()
+	return b.leds[id]
+}
+
+// Returns the number of refreshes during which the led was lit, and the
+// total number of refreshes of its row.
+func (b *MemBackend) LedStats(id LedID) (lit, refreshes uint64) {
+	b.Lock()
+	defer b.Unlock()
+	return b.litCounts[id], b.refreshes[int(id)/len(gpioCols)]
+}
+
+func (b *MemBackend) isDrivenHigh(pin uint) bool {
+	return b.modes[pin] == ModeOutput && b.levels[pin]
+}
+
+// When a led row starts being driven high, the leds on that row are lit
+// for the columns driven low.
+func (b *MemBackend) latchLeds(pin uint, wasDriven bool) {
+	row := pinIndex(ledRows[:], pin)
+	if row < 0 || wasDriven || !b.isDrivenHigh(pin) {
+		return
+	}
+	for colnum, col := range gpioCols {
+		led := row*len(gpioCols) + colnum
+		lit := b.modes[col] == ModeOutput && !b.levels[col]
+		b.leds[led] = lit
+		if lit {
+			b.litCounts[led]++
+		}
+	}
+	b.refreshes[row]++
+}
+
+func pinIndex(pins []uint, pin uint) int {
+	for i, p := range pins {
+		if p == pin {
+			return i
+		}
+	}
+	return -1
+}
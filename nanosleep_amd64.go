@@ -1,6 +0,0 @@
-// This exists only to keep lsp happy on my intel laptop
-
-package pidp11
-
-func nanosleep(ns int64) {
-}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+// Used when not running on a rpi, eg with the in-memory backend.
+// The sleep will typically be longer than requested.
+
+package pidp11
+
+import "time"
+
+func nanosleep(ns int) {
+	time.Sleep(time.Duration(ns))
+}
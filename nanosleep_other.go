@@ -0,0 +1,12 @@
+//go:build linux && !arm && !arm64
+
+// Used when not running on a rpi, eg with the in-memory backend.
+
+package pidp11
+
+import "syscall"
+
+func nanosleep(ns int) {
+	ts := syscall.NsecToTimespec(int64(ns))
+	syscall.Nanosleep(&ts, nil)
+}
@@ -0,0 +1,111 @@
+package pidp11
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Options are given to NewPanel() or Start().
+type Option func(*Panel)
+
+// By default, or if nil, slog.Default() is used.
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *Panel) {
+		if logger == nil {
+			logger = slog.Default()
+		}
+		p.logger = logger
+	}
+}
+
+// The backend used for accessing the GPIO pins, by default the rpi pins.
+func WithBackend(backend Backend) Option {
+	return func(p *Panel) {
+		p.backend = backend
+	}
+}
+
+// See Panel.SetBrightnessScaler().
+func WithBrightnessScaler(scaler Scaler) Option {
+	return func(p *Panel) {
+		p.brightnessScaler = scaler
+	}
+}
+
+// See Panel.SetFrequencyScaler().
+func WithFrequencyScaler(scaler Scaler) Option {
+	return func(p *Panel) {
+		p.frequencyScaler = scaler
+	}
+}
+
+// See Panel.SetBrightnessAdjust().
+func WithBrightnessAdjust(adjust float64) Option {
+	return func(p *Panel) {
+		p.brightnessAdjust = adjust
+	}
+}
+
+// Size of the buffer of the events channel, 100 by default.
+func WithEventBufferSize(size int) Option {
+	return func(p *Panel) {
+		p.eventBufferSize = size
+	}
+}
+
+// What to do when the buffer of the events channel is full, CoalesceKnobs
+// by default.
+func WithEventOverflowPolicy(policy OverflowPolicy) Option {
+	return func(p *Panel) {
+		p.eventPolicy = policy
+	}
+}
+
+// Enables the channel returned by RawEvents(), with the given buffer
+// size.
+func WithRawEvents(size int) Option {
+	return func(p *Panel) {
+		p.rawBufferSize = size
+	}
+}
+
+// Switch readings are only accepted once stable for the given settle
+// times, one for the toggle switches (register switches, TEST, ENABLE/HALT
+// and S_INST/S_BUS_CYCLE) and one for the momentary switches and knobs.
+// There is no debouncing by default.
+func WithDebounce(toggle, momentary time.Duration) Option {
+	return func(p *Panel) {
+		p.debouncer.setSettleTimes(toggle, momentary)
+	}
+}
+
+// Makes fast knob rotations produce larger steps, see KnobAccel.
+// The first matching level, by increasing interval, applies.
+func WithKnobAcceleration(levels ...KnobAccel) Option {
+	return func(p *Panel) {
+		p.knobAccel = sortKnobAccels(levels)
+	}
+}
+
+// Enables the detection of gestures on the momentary switches.
+func WithGestures(gestures Gestures) Option {
+	return func(p *Panel) {
+		p.gestures.cfg = gestures
+	}
+}
+
+// Enables the KindRegister events, emitted when the register switches
+// have been stable for the given window after a change.
+func WithRegisterSettle(window time.Duration) Option {
+	return func(p *Panel) {
+		p.register.settle = window
+	}
+}
+
+// Makes the knobs move the selections of the indicators around them, as on
+// the 11/70, see AddressSelection() and DataSelection().
+func WithKnobSelectors() Option {
+	return func(p *Panel) {
+		p.selectors.enabled = true
+	}
+}
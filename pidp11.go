@@ -1,12 +1,14 @@
 package pidp11
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/stianeikeland/go-rpio/v4"
 )
 
 type LedID int
@@ -14,95 +16,237 @@ type SwitchID int
 type nativeSwitchID int
 
 type Event struct {
-	ID SwitchID
-	On bool
+	ID       SwitchID
+	On       bool
+	Kind     EventKind // KindChange unless gestures are enabled
+	Delta    int       // for the knobs, number of steps, positive clockwise
+	Name     string    // for KindChord and KindSequence, name of the gesture, for KindSelect of the indicator led
+	Value    uint      // for KindRegister, new value of the register switches, for KindSelect position of the knob
+	Previous uint      // for KindRegister, previous value
+	Time     time.Time // when the switch was read, with a monotonic clock reading
+	Scan     uint64    // number of the loop during which the switch was read
+}
+
+// Transition of a physical switch, before the mapping to the synthetic
+// switches of Event. Useful for getting the releases of the momentary
+// switches, or the individual knob contacts.
+type RawEvent struct {
+	Native int    // index of the switch in the matrix, ie row*12+column
+	Name   string // name of the native switch, eg "KNOBA_CW"
+	On     bool   // true if closed, except for TEST which is true if open
+	Time   time.Time
+	Scan   uint64
 }
 
 func (evt Event) IsZero() bool {
 	return evt.ID == SS_NIL
 }
 
-var events chan Event
-var running bool
-var ledSpecs [72]ledSpec
-var switches [38]bool        // current state per nativeSwitchID
-var brightnessAdjust float64 // adjust the max brightness for all leds
-var brigthnessScaler Scaler
-var frequencyScaler Scaler
-var loopμs int // approx. duration of a loop, for converting durations to loops
-var logger *slog.Logger
+var ErrRunning = errors.New("panel already running")
+
+// A PiDP-11 panel, driven through a GPIO backend.
+type Panel struct {
+	mu               sync.Mutex // protects the settings, switches and events
+	lifecycle        sync.Mutex // serialises Start() and Stop()
+	backend          Backend
+	logger           *slog.Logger
+	bus              eventBus
+	events           *Subscription // returned by Events()
+	eventBufferSize  int
+	eventPolicy      OverflowPolicy
+	rawEvents        chan RawEvent // nil unless enabled by WithRawEvents()
+	rawBufferSize    int
+	rawDropped       atomic.Uint64
+	cancel           context.CancelFunc
+	done             chan struct{} // closed when the loop has exited
+	stopErr          error         // error from shutting down the loop
+	ledSpecs         [ledsCount]ledSpec
+	frameMu          sync.Mutex // held during each refresh pass of the leds, see Commit()
+	switches         [38]bool   // current state per nativeSwitchID
+	debouncer        debouncer
+	knobs            [2]knobDecoder
+	knobAccel        []KnobAccel
+	gestures         gestureTracker
+	recognizer       recognizer
+	register         registerTracker
+	selectors        selectors
+	brightnessAdjust float64 // adjust the max brightness for all leds
+	brightnessScaler Scaler
+	frequencyScaler  Scaler
+	loopμs           int // approx. duration of a loop, for converting durations to loops
+}
 
 // Current brightness of the led, and envelope
 type ledSpec struct {
 	sync.Mutex
-	bright int // brightness, 0-31
-	env    envelope
-	name   string // for debug messages
+	bright  int // brightness, 0-31
+	env     envelope
+	state   LedState // as last set, see CaptureScene()
+	builder Envelope // building env, see Effect
+	name    string   // for debug messages
+	panel   *Panel
 }
 
-func Start(logger0 *slog.Logger) error {
-	logger = logger0
-	events = make(chan Event, 100)
-
-	// Sensible defaults
-	if brightnessAdjust == 0 {
-		brightnessAdjust = 1
+// Creates a panel, by default driving the rpi pins and logging to the
+// default slog logger.
+func NewPanel(opts ...Option) *Panel {
+	p := &Panel{
+		backend:          NewRpioBackend(),
+		logger:           slog.Default(),
+		eventBufferSize:  100,
+		eventPolicy:      CoalesceKnobs,
+		brightnessAdjust: 1,
+		brightnessScaler: NewLinearBrightnessScaler(0.03, 1),
+		frequencyScaler:  NewLinearFrequencyScaler(.5, 10, .1),
+		selectors:        newSelectors(),
 	}
-	if brigthnessScaler == nil {
-		brigthnessScaler = NewLinearBrightnessScaler(0.03, 1)
+	for id := LedID(0); id < ledsCount; id++ {
+		p.ledSpecs[id].name = LedName(id)
+		p.ledSpecs[id].panel = p
+		p.ledSpecs[id].builder.spec = &p.ledSpecs[id]
 	}
-	if frequencyScaler == nil {
-		frequencyScaler = NewLinearFrequencyScaler(.5, 10, .1)
+	p.apply(opts)
+	return p
+}
+
+func (p *Panel) apply(opts []Option) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, opt := range opts {
+		opt(p)
 	}
+}
 
-	for id := LedID(0); id < ledsCount; id++ {
-		ledSpecs[id].name = LedName(id)
+// Starts the main loop, after applying the given options.
+// The loop runs until Stop() is called or the context is done, at which
+// point the leds are switched off and the events channel is closed.
+// The panel can be started again after having stopped.
+func (p *Panel) Start(ctx context.Context, opts ...Option) error {
+	p.lifecycle.Lock()
+	defer p.lifecycle.Unlock()
+	if p.done != nil {
+		select {
+		case <-p.done:
+			p.done = nil // stopped by the context, can restart
+		default:
+			return ErrRunning
+		}
 	}
-	if err := rpio.Open(); err != nil {
+	p.apply(opts)
+	if err := p.backend.Open(); err != nil {
 		return err
 	}
 
-	running = true
+	p.mu.Lock()
+	p.events = p.bus.subscribe(SubscribeOptions{
+		Buffer: p.eventBufferSize,
+		Policy: p.eventPolicy,
+	})
+	p.rawEvents = nil
+	if p.rawBufferSize > 0 {
+		p.rawEvents = make(chan RawEvent, p.rawBufferSize)
+	}
+	p.mu.Unlock()
+	ctx, p.cancel = context.WithCancel(ctx)
+	p.done = make(chan struct{})
+	p.stopErr = nil
+
 	// Time the loop
-	timingChan := make(chan int)
+	timingChan := make(chan int, 1)
 	timingLoops := 3000
-	go loop(timingChan, timingLoops)
-	loopμs = <-timingChan / timingLoops
-	close(timingChan)
-	logger.Info("estimed loop duration", "μs", loopμs)
-	return nil
+	go p.loop(ctx, p.done, timingChan, timingLoops)
+	select {
+	case total := <-timingChan:
+		μs := max(total/timingLoops, 1)
+		p.mu.Lock()
+		p.loopμs = μs
+		p.mu.Unlock()
+		p.logger.Info("estimed loop duration", "μs", μs)
+		p.lightSelectors()
+		return nil
+	case <-p.done:
+		p.done = nil
+		if p.stopErr != nil {
+			return p.stopErr
+		}
+		return ctx.Err()
+	}
 }
 
-func Stop() error {
-	logger.Info("Pidp.Stop")
-	if !running {
+// Stops the main loop and waits for it to exit, the leds being then
+// switched off. Returns the error from closing the backend, if any.
+func (p *Panel) Stop() error {
+	p.lifecycle.Lock()
+	defer p.lifecycle.Unlock()
+	p.logger.Info("Pidp.Stop")
+	if p.done == nil {
 		return nil
 	}
-	running = false
-	ClearLeds(0)
-	time.Sleep(50 * time.Millisecond) // wait for the loop to notice
-	return rpio.Close()
+	p.cancel()
+	<-p.done
+	p.done = nil
+	return p.stopErr
 }
 
-func Events() <-chan Event {
-	return events
+// Returns the channel of switch events, which is closed when the panel
+// stops. A new channel is created every time the panel starts.
+// This is a subscription receiving all events, see Subscribe().
+func (p *Panel) Events() <-chan Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.events == nil {
+		return nil
+	}
+	return p.events.C
 }
 
-func GetBrightnessAdjust() float64 {
-	return brightnessAdjust
+// Number of events dropped since the start because the channel returned
+// by Events() was not read quickly enough.
+func (p *Panel) EventsDropped() uint64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.events == nil {
+		return 0
+	}
+	return p.events.Dropped()
+}
+
+// Number of raw events dropped since the panel was created because the
+// channel returned by RawEvents() was not read quickly enough.
+func (p *Panel) RawEventsDropped() uint64 {
+	return p.rawDropped.Load()
+}
+
+// Returns the channel of raw switch transitions, nil unless enabled with
+// WithRawEvents(). Like the events channel it is closed when the panel
+// stops.
+func (p *Panel) RawEvents() <-chan RawEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.rawEvents
+}
+
+func (p *Panel) GetBrightnessAdjust() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.brightnessAdjust
 }
 
 // Sets the global brightness level - eg if in a dark room you could use
 // a low value.
-func SetBrightnessAdjust(adjust float64) {
-	brightnessAdjust = adjust
+func (p *Panel) SetBrightnessAdjust(adjust float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.brightnessAdjust = adjust
 }
 
 // The Led() function is passed a "logical" brightness param [0,  1].
 // If non-zero, this value will be mapped to a "physical" value controlling
 // the number of cycles the led will stay on/off.
-func SetBrightnessScaler(scaler Scaler) {
-	brigthnessScaler = scaler
+func (p *Panel) SetBrightnessScaler(scaler Scaler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.brightnessScaler = scaler
 }
 
 // When the Led() function is given a flashing or strobing effect,
@@ -113,64 +257,129 @@ func SetBrightnessScaler(scaler Scaler) {
 //   - The min frequency should not be so low that the led looks off.
 //   - The max frequency should not be higher than necessary, as high
 //     frequencies are difficult to differentiate visually.
-func SetFrequencyScaler(scaler Scaler) {
-	frequencyScaler = scaler
+func (p *Panel) SetFrequencyScaler(scaler Scaler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.frequencyScaler = scaler
+}
+
+func (p *Panel) scaleFrequency(param float64) float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.frequencyScaler.Scale(param)
+}
+
+// Returns the approximate duration of a refresh of the leds, measured by
+// Start(), zero before.
+func (p *Panel) LoopDuration() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return time.Duration(p.loopμs) * time.Microsecond
+}
+
+// Returns the duration of a loop for converting durations to loops, the
+// nominal one before Start().
+func (p *Panel) loopDurationμs() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.loopμs <= 0 {
+		return nominalLoopμs
+	}
+	return p.loopμs
 }
 
 // Switches off all leds, ramping down brightness for the given duration.
-func ClearLeds(offMs int) {
+// The indicators of the knob selectors stay lit, see WithKnobSelectors().
+func (p *Panel) ClearLeds(offMs int) {
+	p.ClearLedsExcept(offMs, nil)
+}
+
+// Like ClearLeds(), but leaves the given leds alone.
+func (p *Panel) ClearLedsExcept(offMs int, keep []LedID) {
 	fx := NewSimpleEffect(0, offMs)
+	f := NewFrame()
 	for id := LedID(0); id < ledsCount; id++ {
-		Led(LedID(id), 0, fx)
+		if !p.isSelectorLed(id) && !slices.Contains(keep, id) {
+			f.Led(id, 0, fx)
+		}
 	}
+	p.Commit(f)
 }
 
 // Sets the led state.
 // The brightness is a [0, 1] value.
 // The other parameters are interpreted by the effect, which may
 // decide to panic if the parameters are invalid.
-func Led(id LedID, brightP float64, fx Effect, fxParams ...float64) {
-	spec := &ledSpecs[id]
-	logger.Debug("Led", "led", spec.name, "brightnessP", brightP, "fx", fx, "fxParams", fxParams)
-	brightP = brigthnessScaler.Scale(brightP) * brightnessAdjust
+func (p *Panel) Led(id LedID, brightP float64, fx Effect, fxParams ...float64) {
+	spec := &p.ledSpecs[id]
+	p.logger.Debug("Led", "led", spec.name, "brightnessP", brightP, "fx", fx, "fxParams", fxParams)
+	p.mu.Lock()
+	scaled := p.brightnessScaler.Scale(brightP) * p.brightnessAdjust
+	p.mu.Unlock()
+	state := LedState{brightP, fx, cloneParams(fxParams)}
+	spec.set(scaled, state, fx, fxParams...)
+}
+
+// Makes the envelope for the scaled brightness, preserving the progress
+// through the previous one, and records the state set by the caller.
+func (spec *ledSpec) set(brightP float64, state LedState, fx Effect, fxParams ...float64) {
 	spec.Lock()
 	defer spec.Unlock()
+	spec.state = state
 	progress := spec.getProgress()
 	spec.makeEnvelope(brightP, fx, fxParams...)
 	spec.setProgress(progress)
 }
 
+// Returns the current brightness of the led, in [0, 1], after scaling.
+func (p *Panel) Brightness(id LedID) float64 {
+	spec := &p.ledSpecs[id]
+	spec.Lock()
+	defer spec.Unlock()
+	return float64(spec.bright) / float64(brightnessSteps-1)
+}
+
 func (spec *ledSpec) isOn(counter int) bool {
+	spec.Lock()
+	defer spec.Unlock()
 	spec.step()
 	return brightnessPhases[spec.bright][counter%(brightnessSteps-1)]
 }
 
-func loop(timingChan chan int, timingLoops int) {
+func (p *Panel) loop(ctx context.Context, done chan struct{}, timingChan chan int, timingLoops int) {
+	backend := p.backend
+	rawEvents := p.rawEvents
+	var failed <-chan struct{}
+	if fb, ok := backend.(FailingBackend); ok {
+		failed = fb.Failed()
+	}
+	defer p.shutdown(rawEvents, done)
 	// All pins as inputs, pull-ups on columns, pull-offs on rows
 	for _, ledrow := range ledRows {
-		pin := rpio.Pin(ledrow)
-		pin.Input()
-		pin.Low()
+		backend.Mode(ledrow, ModeInput)
+		backend.Write(ledrow, false)
 	}
 	for _, col := range gpioCols {
-		rpio.Pin(col).Input()
+		backend.Mode(col, ModeInput)
 	}
 	for _, row := range gpioRows {
-		rpio.Pin(row).Input()
+		backend.Mode(row, ModeInput)
 	}
 	for _, col := range gpioCols {
-		rpio.Pin(col).PullUp()
+		backend.Pull(col, PullUp)
 	}
 	for _, ledrow := range ledRows {
-		rpio.Pin(ledrow).PullOff()
+		backend.Pull(ledrow, PullOff)
 	}
 	for _, row := range gpioRows {
-		rpio.Pin(row).PullOff()
+		backend.Pull(row, PullOff)
 	}
 
-	// Main loop, exits when .running is false
+	// Main loop, exits when the context is done
 	counter := 1
 	start := time.Now()
+	var evts []Event
+	var rawEvts []RawEvent
 	for {
 		if counter == timingLoops {
 			μs := int(time.Now().Sub(start).Microseconds())
@@ -178,61 +387,169 @@ func loop(timingChan chan int, timingLoops int) {
 		}
 
 		// LEDs
+		p.frameMu.Lock()
 		for _, col := range gpioCols {
-			rpio.Pin(col).Output()
+			backend.Mode(col, ModeOutput)
 		}
 		for ledrownum, ledrow := range ledRows {
 			for colnum, col := range gpioCols {
 				led := ledrownum*len(gpioCols) + colnum
-				if ledSpecs[led].isOn(counter) {
-					rpio.Pin(col).Low()
+				if p.ledSpecs[led].isOn(counter) {
+					backend.Write(col, false)
 				} else {
-					rpio.Pin(col).High()
+					backend.Write(col, true)
 				}
 			}
-			rpio.Pin(ledrow).High()
-			rpio.Pin(ledrow).Output()
+			backend.Write(ledrow, true)
+			backend.Mode(ledrow, ModeOutput)
 			nanosleep(5e4) // led is on
-			rpio.Pin(ledrow).Low()
+			backend.Write(ledrow, false)
 			nanosleep(antiGhostingPauseNs)
 		}
+		p.frameMu.Unlock()
 
 		// Switches
 		for _, col := range gpioCols {
-			rpio.Pin(col).Input()
+			backend.Mode(col, ModeInput)
 		}
+		evts = evts[:0]
+		rawEvts = rawEvts[:0]
 		for rownum, row := range gpioRows {
-			rpio.Pin(row).Output()
-			rpio.Pin(row).Low()
+			backend.Mode(row, ModeOutput)
+			backend.Write(row, false)
 			nanosleep(500)
+			now := time.Now()
+			p.mu.Lock()
 			for colnum, col := range gpioCols {
-				reading := rpio.Pin(col).Read()
+				reading := backend.Read(col)
 				nid := nativeSwitchID(rownum*len(gpioCols) + colnum)
-				oldState := switches[nid]
-				newState := reading == rpio.Low
+				oldState := p.switches[nid]
+				newState := !reading
 				if nid == swTEST {
 					// Have false for rest position
 					newState = !newState
 				}
-				switches[nid] = newState
+				if counter == 1 {
+					// Initial state, no events
+					p.debouncer.seed(nid, newState)
+					p.switches[nid] = newState
+					p.initKnob(nid, newState)
+					continue
+				}
+				if !p.debouncer.settled(nid, newState, now) {
+					continue
+				}
+				p.switches[nid] = newState
 				if newState != oldState {
-					evt := makeEvent(nid, newState)
-					if evt.ID != SS_NIL {
-						events <- evt
+					scan := uint64(counter)
+					if rawEvents != nil {
+						rawEvts = append(rawEvts, RawEvent{
+							Native: int(nid),
+							Name:   nativeSwitchName(nid),
+							On:     newState,
+							Time:   now,
+							Scan:   scan,
+						})
 					}
+					evts = p.switchEvents(evts, nid, newState, now, scan)
 				}
 			}
-			rpio.Pin(row).Input()
+			p.mu.Unlock()
+			backend.Mode(row, ModeInput)
+		}
+		p.mu.Lock()
+		evts = p.timedEvents(evts, time.Now(), uint64(counter))
+		p.mu.Unlock()
+		for _, evt := range rawEvts {
+			select {
+			case rawEvents <- evt:
+			default:
+				p.rawDropped.Add(1)
+			}
+		}
+		evts = p.selectKnobs(evts)
+		for _, evt := range evts {
+			p.bus.publish(evt)
 		}
 
-		if !running {
-			break
+		select {
+		case <-ctx.Done():
+			return
+		case <-failed:
+			p.logger.Error("backend failed, stopping")
+			return
+		default:
 		}
 		counter++
 	}
 }
 
-func makeEvent(nid nativeSwitchID, state bool) Event {
+// Called when the loop exits: switches off the leds, closes the backend
+// and the events channels.
+func (p *Panel) shutdown(rawEvents chan RawEvent, done chan struct{}) {
+	for _, ledrow := range ledRows {
+		p.backend.Write(ledrow, false)
+		p.backend.Mode(ledrow, ModeInput)
+	}
+	for _, col := range gpioCols {
+		p.backend.Mode(col, ModeInput)
+	}
+	for id := range p.ledSpecs {
+		spec := &p.ledSpecs[id]
+		spec.Lock()
+		spec.env.reset()
+		spec.bright = 0
+		spec.state = LedState{}
+		spec.Unlock()
+	}
+	p.stopErr = p.backend.Close()
+	p.bus.closeAll()
+	if rawEvents != nil {
+		close(rawEvents)
+	}
+	close(done)
+}
+
+// Appends the events resulting from a switch change.
+// Must be called with the panel mutex held.
+func (p *Panel) switchEvents(evts []Event, nid nativeSwitchID, state bool, now time.Time, scan uint64) []Event {
+	evt := p.makeEvent(nid, state, now)
+	if evt.ID != SS_NIL {
+		evts = p.appendEvents(evts, now, scan, evt)
+	}
+	if id := momentarySwitchID(nid); id != SS_NIL {
+		evts = p.appendEvents(evts, now, scan, p.gestures.update(id, state, now)...)
+	}
+	if nid >= swSR0 && nid <= swSR21 {
+		p.register.update(now)
+	}
+	return evts
+}
+
+// Appends the events depending on the passing of time, eg long presses.
+// Must be called with the panel mutex held.
+func (p *Panel) timedEvents(evts []Event, now time.Time, scan uint64) []Event {
+	if scan == 1 {
+		p.register.value = p.regSwitches() // initial value
+	}
+	evts = p.appendEvents(evts, now, scan, p.gestures.tick(now)...)
+	evts = p.appendEvents(evts, now, scan, p.register.tick(now, p.regSwitches())...)
+	return p.recognizerTick(evts, now)
+}
+
+// Appends the events, after passing them through the chords and sequences
+// recognizer.
+func (p *Panel) appendEvents(evts []Event, now time.Time, scan uint64, newEvts ...Event) []Event {
+	for _, evt := range newEvts {
+		evt.Time = now
+		evt.Scan = scan
+		evts = p.recognize(evts, evt)
+	}
+	return evts
+}
+
+// Must be called with the panel mutex held.
+func (p *Panel) makeEvent(nid nativeSwitchID, state bool, now time.Time) Event {
 	synEvt := Event{}
 
 	doMomentary := func(id SwitchID) {
@@ -243,7 +560,7 @@ func makeEvent(nid nativeSwitchID, state bool) Event {
 
 	switch nid {
 	case swKNOBA_CW, swKNOBA_ACW, swKNOBD_CW, swKNOBD_ACW:
-		synEvt = eventForKnob(nid, state)
+		synEvt = p.eventForKnob(nid, state, now)
 	case swKNOBA_PUSH:
 		doMomentary(SS_KNOBA_PUSH)
 	case swKNOBD_PUSH:
@@ -259,24 +576,16 @@ func makeEvent(nid nativeSwitchID, state bool) Event {
 	case swCONT:
 		doMomentary(SS_CONT)
 	case swENABLE:
-		id := SS_ENABLE
-		if state {
-			id = SS_HALT
-		}
-		synEvt = Event{ID: id, On: true}
+		synEvt = Event{ID: SS_HALT, On: state}
 	case swSINST:
-		id := SS_S_INST
-		if state {
-			id = SS_S_BUS_CYCLE
-		}
-		synEvt = Event{ID: id, On: true}
+		synEvt = Event{ID: SS_S_BUS_CYCLE, On: state}
 	case swSTART:
 		doMomentary(SS_START)
 	}
 	// Register switches: as well as emitting an event, we track
 	// the position of the switches, see Pidp.ReadRegSwitches()
 	if nid >= swSR0 && nid <= swSR21 {
-		switches[nid] = state
+		p.switches[nid] = state
 		synEvt = Event{
 			ID: SS_SR0 + SwitchID(nid-swSR0),
 			On: state,
@@ -285,17 +594,6 @@ func makeEvent(nid nativeSwitchID, state bool) Event {
 	return synEvt
 }
 
-// Returns the integer indicated by the register switches.
-func ReadRegSwitches() uint {
-	val := uint(0)
-	for i := range 22 {
-		if switches[SwitchID(i)] {
-			val ^= 1 << i
-		}
-	}
-	return val
-}
-
 func assert(b bool, format string, args ...any) {
 	if !b {
 		panic(fmt.Sprintf("assertion failed: "+format, args...))
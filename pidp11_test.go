@@ -0,0 +1,559 @@
+package pidp11_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+// Starts a panel on the in-memory backend, stopped at the end of the test.
+func startPanel(t *testing.T, opts ...pidp11.Option) (*pidp11.Panel, *pidp11.MemBackend) {
+	t.Helper()
+	mem := pidp11.NewMemBackend()
+	opts = append([]pidp11.Option{
+		pidp11.WithBackend(mem),
+		pidp11.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	}, opts...)
+	p := pidp11.NewPanel(opts...)
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Stop() })
+	return p, mem
+}
+
+// Returns the next event of the subscription, failing after a second.
+func nextEvent(t *testing.T, sub *pidp11.Subscription) pidp11.Event {
+	t.Helper()
+	select {
+	case evt := <-sub.C:
+		return evt
+	case <-time.After(time.Second):
+		t.Fatal("no event")
+	}
+	return pidp11.Event{}
+}
+
+// Fails unless the condition becomes true within a second.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestLedLevels(t *testing.T) {
+	p, mem := startPanel(t)
+	fx := pidp11.NewSimpleEffect(0, 0)
+	p.Led(pidp11.LED_A0, 1, fx)
+	p.Led(pidp11.LED_A1, .5, fx)
+	p.Led(pidp11.LED_A2, 0, fx)
+	time.Sleep(20 * time.Millisecond)
+
+	var lit0, refreshes0 [3]uint64
+	for i := range 3 {
+		lit0[i], refreshes0[i] = mem.LedStats(pidp11.LED_A0 + pidp11.LedID(i))
+	}
+	time.Sleep(200 * time.Millisecond)
+	for i, want := range []float64{1, p.Brightness(pidp11.LED_A1), 0} {
+		id := pidp11.LED_A0 + pidp11.LedID(i)
+		lit, refreshes := mem.LedStats(id)
+		duty := float64(lit-lit0[i]) / float64(refreshes-refreshes0[i])
+		if math.Abs(duty-want) > .05 {
+			t.Errorf("%s: lit during %.2f of the refreshes, want %.2f", pidp11.LedName(id), duty, want)
+		}
+	}
+	if !mem.Led(pidp11.LED_A0) || mem.Led(pidp11.LED_A2) {
+		t.Errorf("A0 lit %v, A2 lit %v", mem.Led(pidp11.LED_A0), mem.Led(pidp11.LED_A2))
+	}
+}
+
+func TestSwitchEvents(t *testing.T) {
+	p, mem := startPanel(t)
+	sub := p.Subscribe(pidp11.SubscribeOptions{})
+	defer sub.Close()
+
+	mem.SetSwitchByID(pidp11.SS_SR3, true)
+	if evt := nextEvent(t, sub); evt.ID != pidp11.SS_SR3 || !evt.On {
+		t.Errorf("got %v, want SR3 on", evt)
+	}
+	mem.SetSwitchByID(pidp11.SS_SR3, false)
+	if evt := nextEvent(t, sub); evt.ID != pidp11.SS_SR3 || evt.On {
+		t.Errorf("got %v, want SR3 off", evt)
+	}
+	mem.SetSwitchByID(pidp11.SS_START, true)
+	if evt := nextEvent(t, sub); evt.ID != pidp11.SS_START || !evt.On {
+		t.Errorf("got %v, want START pressed", evt)
+	}
+	mem.SetSwitchByID(pidp11.SS_START, false)
+}
+
+func TestRegisterReadBack(t *testing.T) {
+	p, mem := startPanel(t)
+	want := uint(1 | 1<<5 | 1<<21)
+	for _, id := range []pidp11.SwitchID{pidp11.SS_SR0, pidp11.SS_SR5, pidp11.SS_SR21} {
+		mem.SetSwitchByID(id, true)
+	}
+	eventually(t, "register switches", func() bool {
+		return p.ReadRegSwitches() == want
+	})
+	mem.SetSwitchByID(pidp11.SS_SR5, false)
+	eventually(t, "SR5 off", func() bool {
+		return p.ReadRegSwitches() == want&^(1<<5)
+	})
+}
+
+func TestInitialStateWithDebounce(t *testing.T) {
+	mem := pidp11.NewMemBackend()
+	mem.SetSwitchByID(pidp11.SS_SR3, true)
+	mem.SetSwitchByID(pidp11.SS_HALT, true)
+	p := pidp11.NewPanel(
+		pidp11.WithBackend(mem),
+		pidp11.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+		pidp11.WithDebounce(20*time.Millisecond, 5*time.Millisecond),
+		pidp11.WithRegisterSettle(10*time.Millisecond),
+	)
+	sub := p.Subscribe(pidp11.SubscribeOptions{})
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	if !p.SwitchState(pidp11.SS_HALT) || p.ReadRegSwitches() != 1<<3 {
+		t.Errorf("initial state: HALT %v, register %o", p.SwitchState(pidp11.SS_HALT), p.ReadRegSwitches())
+	}
+	select {
+	case evt := <-sub.C:
+		t.Errorf("event for the initial state: %v", evt)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestToggleEvents(t *testing.T) {
+	p, mem := startPanel(t)
+	sub := p.Subscribe(pidp11.SubscribeOptions{})
+	defer sub.Close()
+	for _, tc := range []struct {
+		id       pidp11.SwitchID
+		on       bool
+		position pidp11.SwitchID // true for SwitchState()
+	}{
+		{pidp11.SS_HALT, true, pidp11.SS_HALT},
+		{pidp11.SS_HALT, false, pidp11.SS_ENABLE},
+		{pidp11.SS_S_BUS_CYCLE, true, pidp11.SS_S_BUS_CYCLE},
+		{pidp11.SS_S_BUS_CYCLE, false, pidp11.SS_S_INST},
+	} {
+		mem.SetSwitchByID(tc.id, tc.on)
+		evt := nextEvent(t, sub)
+		if evt.ID != tc.id || evt.On != tc.on {
+			t.Errorf("got %v, want %s on=%v", evt, pidp11.SwitchName(tc.id), tc.on)
+		}
+		if !p.SwitchState(tc.position) {
+			t.Errorf("SwitchState(%s) false", pidp11.SwitchName(tc.position))
+		}
+	}
+}
+
+func TestSelectorsStayLit(t *testing.T) {
+	p, _ := startPanel(t, pidp11.WithKnobSelectors())
+	p.ClearLeds(0)
+	if err := p.ShowScene(context.Background(), &pidp11.Scene{}, pidp11.Transition{Kind: pidp11.Cut}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	for _, id := range []pidp11.LedID{pidp11.LED_PROG_PHY, pidp11.LED_DATA_PATHS} {
+		if p.Brightness(id) != 1 {
+			t.Errorf("%s: brightness %v", pidp11.LedName(id), p.Brightness(id))
+		}
+	}
+}
+
+// Effect with levels out of [0, 1].
+type wildEffect struct{ level float64 }
+
+func (fx wildEffect) MakeEnvelope(env *pidp11.Envelope, bright float64, params ...float64) {
+	env.AddStage(fx.level, -fx.level, -10, false)
+	env.AddStage(env.Current(), fx.level, 0, true)
+}
+
+func TestEffectLevelsClamped(t *testing.T) {
+	p, _ := startPanel(t)
+	for level, want := range map[float64]float64{2: 1, -1: 0, math.NaN(): 0, math.Inf(1): 1} {
+		p.Led(pidp11.LED_RUN, 1, wildEffect{level})
+		eventually(t, fmt.Sprint("brightness for level ", level), func() bool {
+			return p.Brightness(pidp11.LED_RUN) == want
+		})
+	}
+}
+
+// Fails if the subscription delivers an event within the duration.
+func noEvent(t *testing.T, sub *pidp11.Subscription, d time.Duration) {
+	t.Helper()
+	select {
+	case evt := <-sub.C:
+		t.Errorf("unexpected event %v", evt)
+	case <-time.After(d):
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	p, mem := startPanel(t, pidp11.WithDebounce(50*time.Millisecond, 50*time.Millisecond))
+	sub := p.Subscribe(pidp11.SubscribeOptions{})
+	defer sub.Close()
+
+	// Bounces shorter than the window
+	for _, id := range []pidp11.SwitchID{pidp11.SS_SR0 + 3, pidp11.SS_START} {
+		for range 3 {
+			mem.SetSwitchByID(id, true)
+			time.Sleep(10 * time.Millisecond)
+			mem.SetSwitchByID(id, false)
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	noEvent(t, sub, 150*time.Millisecond)
+	if p.SwitchState(pidp11.SS_SR0 + 3) {
+		t.Error("SR3 on after bouncing")
+	}
+
+	// Stable changes
+	for _, id := range []pidp11.SwitchID{pidp11.SS_SR0 + 3, pidp11.SS_START} {
+		changed := time.Now()
+		mem.SetSwitchByID(id, true)
+		evt := nextEvent(t, sub)
+		if evt.ID != id || !evt.On {
+			t.Errorf("got %v, want %s on", evt, pidp11.SwitchName(id))
+		}
+		if elapsed := time.Since(changed); elapsed < 50*time.Millisecond {
+			t.Errorf("%s accepted after %v", pidp11.SwitchName(id), elapsed)
+		}
+	}
+}
+
+func TestRawEvents(t *testing.T) {
+	p, mem := startPanel(t, pidp11.WithRawEvents(10))
+	raw := p.RawEvents()
+	next := func() pidp11.RawEvent {
+		t.Helper()
+		select {
+		case evt := <-raw:
+			return evt
+		case <-time.After(time.Second):
+			t.Fatal("no raw event")
+		}
+		return pidp11.RawEvent{}
+	}
+
+	// The release of a momentary switch, not emitted as an event
+	mem.SetSwitchByID(pidp11.SS_START, true)
+	time.Sleep(10 * time.Millisecond)
+	mem.SetSwitchByID(pidp11.SS_START, false)
+	for _, on := range []bool{true, false} {
+		if evt := next(); evt.Name != "START" || evt.On != on || evt.Scan == 0 {
+			t.Errorf("got %+v, want START on=%v", evt, on)
+		}
+	}
+
+	// The individual knob contacts, clockwise first
+	mem.TurnKnob(pidp11.SS_KNOBA, true, 5*time.Millisecond)
+	for _, want := range []pidp11.RawEvent{
+		{Name: "KNOBA_CW", On: true}, {Name: "KNOBA_ACW", On: true},
+		{Name: "KNOBA_CW", On: false}, {Name: "KNOBA_ACW", On: false},
+	} {
+		if evt := next(); evt.Name != want.Name || evt.On != want.On {
+			t.Errorf("got %+v, want %s on=%v", evt, want.Name, want.On)
+		}
+	}
+	p.Stop()
+	if _, ok := <-raw; ok {
+		t.Error("raw events channel not closed")
+	}
+}
+
+func TestGestures(t *testing.T) {
+	p, mem := startPanel(t, pidp11.WithGestures(pidp11.Gestures{
+		Release:     true,
+		LongPress:   100 * time.Millisecond,
+		DoublePress: 200 * time.Millisecond,
+	}))
+	sub := p.Subscribe(pidp11.SubscribeOptions{})
+	defer sub.Close()
+	expect := func(id pidp11.SwitchID, kinds ...pidp11.EventKind) {
+		t.Helper()
+		for _, kind := range kinds {
+			if evt := nextEvent(t, sub); evt.ID != id || evt.Kind != kind {
+				t.Errorf("got %v, want %s %s", evt, pidp11.SwitchName(id), kind)
+			}
+		}
+	}
+
+	// Long press, emitted while held
+	pressed := time.Now()
+	mem.SetSwitchByID(pidp11.SS_EXAM, true)
+	expect(pidp11.SS_EXAM, pidp11.KindChange, pidp11.KindLongPress)
+	if elapsed := time.Since(pressed); elapsed < 100*time.Millisecond {
+		t.Errorf("long press after %v", elapsed)
+	}
+	mem.SetSwitchByID(pidp11.SS_EXAM, false)
+	expect(pidp11.SS_EXAM, pidp11.KindRelease)
+
+	// Double press
+	for range 2 {
+		mem.SetSwitchByID(pidp11.SS_DEP, true)
+		time.Sleep(20 * time.Millisecond)
+		mem.SetSwitchByID(pidp11.SS_DEP, false)
+		time.Sleep(20 * time.Millisecond)
+	}
+	expect(pidp11.SS_DEP, pidp11.KindChange, pidp11.KindRelease, pidp11.KindChange, pidp11.KindDoublePress, pidp11.KindRelease)
+
+	// Presses too far apart
+	time.Sleep(250 * time.Millisecond)
+	for range 2 {
+		mem.SetSwitchByID(pidp11.SS_DEP, true)
+		time.Sleep(20 * time.Millisecond)
+		mem.SetSwitchByID(pidp11.SS_DEP, false)
+		time.Sleep(250 * time.Millisecond)
+	}
+	expect(pidp11.SS_DEP, pidp11.KindChange, pidp11.KindRelease, pidp11.KindChange, pidp11.KindRelease)
+	noEvent(t, sub, 50*time.Millisecond)
+}
+
+func TestRegisterSettle(t *testing.T) {
+	p, mem := startPanel(t, pidp11.WithRegisterSettle(50*time.Millisecond))
+	sub := p.Subscribe(pidp11.SubscribeOptions{Kinds: []pidp11.EventKind{pidp11.KindRegister}})
+	defer sub.Close()
+	changed := time.Now()
+	for _, id := range []pidp11.SwitchID{pidp11.SS_SR0, pidp11.SS_SR1, pidp11.SS_SR2} {
+		mem.SetSwitchByID(id, true)
+		changed = time.Now()
+		time.Sleep(10 * time.Millisecond)
+	}
+	evt := nextEvent(t, sub)
+	if elapsed := time.Since(changed); elapsed < 50*time.Millisecond {
+		t.Errorf("settled after %v", elapsed)
+	}
+	if evt.ID != pidp11.SS_REGISTER || evt.Value != 7 || evt.Previous != 0 {
+		t.Errorf("got %v, want register 7 from 0", evt)
+	}
+	noEvent(t, sub, 100*time.Millisecond)
+
+	mem.SetSwitchByID(pidp11.SS_SR1, false)
+	if evt := nextEvent(t, sub); evt.Value != 5 || evt.Previous != 7 {
+		t.Errorf("got %v, want register 5 from 7", evt)
+	}
+
+	// Back to the reported value before settling
+	mem.SetSwitchByID(pidp11.SS_SR3, true)
+	time.Sleep(10 * time.Millisecond)
+	mem.SetSwitchByID(pidp11.SS_SR3, false)
+	noEvent(t, sub, 100*time.Millisecond)
+}
+
+func TestDisplay(t *testing.T) {
+	p, _ := startPanel(t)
+	fx := pidp11.NewSimpleEffect(0, 0)
+	lit := func(id pidp11.LedID) bool {
+		return p.CaptureScene().Led(id).Brightness == 1
+	}
+	for _, tc := range []struct {
+		width   pidp11.AddressWidth
+		lit     pidp11.LedID
+		highest pidp11.LedID // highest address led shown
+	}{
+		{pidp11.Addr16, pidp11.LED_ADDR_16, pidp11.LED_A15},
+		{pidp11.Addr18, pidp11.LED_ADDR_18, pidp11.LED_A17},
+		{pidp11.Addr22, pidp11.LED_ADDR_22, pidp11.LED_A21},
+	} {
+		p.ShowAddress(1<<22-1, tc.width, fx)
+		for _, id := range []pidp11.LedID{pidp11.LED_ADDR_16, pidp11.LED_ADDR_18, pidp11.LED_ADDR_22} {
+			if lit(id) != (id == tc.lit) {
+				t.Errorf("width %d: %s lit %v", tc.width, pidp11.LedName(id), lit(id))
+			}
+		}
+		for id := pidp11.LED_A0; id <= pidp11.LED_A21; id++ {
+			if lit(id) != (id <= tc.highest) {
+				t.Errorf("width %d: %s lit %v", tc.width, pidp11.LedName(id), lit(id))
+			}
+		}
+	}
+
+	for _, tc := range []struct {
+		val          uint16
+		parLo, parHi bool
+	}{
+		{0, true, true},
+		{0o1, false, true},
+		{0o3, true, true},
+		{0o400, true, false},
+		{0o177777, true, true},
+		{0o100001, false, false},
+	} {
+		p.ShowData(tc.val, fx)
+		if lit(pidp11.LED_PAR_LO) != tc.parLo || lit(pidp11.LED_PAR_HI) != tc.parHi {
+			t.Errorf("data %o: PAR_LO %v, PAR_HI %v", tc.val, lit(pidp11.LED_PAR_LO), lit(pidp11.LED_PAR_HI))
+		}
+		for i := range 16 {
+			id := pidp11.LED_D0 + pidp11.LedID(i)
+			if lit(id) != (tc.val&(1<<i) != 0) {
+				t.Errorf("data %o: %s lit %v", tc.val, pidp11.LedName(id), lit(id))
+			}
+		}
+	}
+}
+
+func TestSelectors(t *testing.T) {
+	p, mem := startPanel(t, pidp11.WithKnobSelectors())
+	sub := p.Subscribe(pidp11.SubscribeOptions{Kinds: []pidp11.EventKind{pidp11.KindSelect}})
+	defer sub.Close()
+	for _, tc := range []struct {
+		knob pidp11.SwitchID
+		cw   bool
+		want pidp11.LedID
+		pos  uint
+	}{
+		{pidp11.SS_KNOBD, false, pidp11.LED_BUS_REG, 3}, // wraps from DATA_PATHS
+		{pidp11.SS_KNOBD, true, pidp11.LED_DATA_PATHS, 0},
+		{pidp11.SS_KNOBD, true, pidp11.LED_μADR_FPP_CPU, 1},
+		{pidp11.SS_KNOBA, true, pidp11.LED_CONS_PHY, 5},
+		{pidp11.SS_KNOBA, true, pidp11.LED_KERNEL_D, 6},
+		{pidp11.SS_KNOBA, true, pidp11.LED_SUPER_D, 7},
+		{pidp11.SS_KNOBA, true, pidp11.LED_USER_D, 0}, // wraps from SUPER_D
+		{pidp11.SS_KNOBA, false, pidp11.LED_SUPER_D, 7},
+	} {
+		mem.TurnKnob(tc.knob, tc.cw, 5*time.Millisecond)
+		evt := nextEvent(t, sub)
+		if evt.ID != tc.knob || evt.Name != pidp11.LedName(tc.want) || evt.Value != tc.pos {
+			t.Errorf("got %v, want %s at %d", evt, pidp11.LedName(tc.want), tc.pos)
+		}
+		selected := p.DataSelection()
+		if tc.knob == pidp11.SS_KNOBA {
+			selected = p.AddressSelection()
+		}
+		if selected != tc.want {
+			t.Errorf("selected %s, want %s", pidp11.LedName(selected), pidp11.LedName(tc.want))
+		}
+		if p.CaptureScene().Led(tc.want).Brightness != 1 {
+			t.Errorf("%s not lit", pidp11.LedName(tc.want))
+		}
+	}
+	if p.CaptureScene().Led(pidp11.LED_USER_D).Brightness != 0 {
+		t.Error("USER_D still lit")
+	}
+}
+
+func TestCommitAtomic(t *testing.T) {
+	p, mem := startPanel(t)
+	fx := pidp11.NewSimpleEffect(0, 0)
+	frame := func(bright float64) *pidp11.Frame {
+		f := pidp11.NewFrame()
+		for i := range 16 {
+			f.Led(pidp11.LED_D0+pidp11.LedID(i), bright, fx)
+		}
+		return f
+	}
+	on, off := frame(1), frame(0)
+	// Waits for a couple of passes, with the leds off
+	settle := func() []uint64 {
+		t.Helper()
+		p.Commit(off)
+		_, start0 := mem.LedStats(pidp11.LED_D0)
+		_, start15 := mem.LedStats(pidp11.LED_D15)
+		eventually(t, "refreshes", func() bool {
+			_, refreshes0 := mem.LedStats(pidp11.LED_D0)
+			_, refreshes15 := mem.LedStats(pidp11.LED_D15)
+			return refreshes0 >= start0+2 && refreshes15 >= start15+2
+		})
+		counts := make([]uint64, 16)
+		for i := range counts {
+			counts[i], _ = mem.LedStats(pidp11.LED_D0 + pidp11.LedID(i))
+		}
+		return counts
+	}
+	before := settle()
+	for range 200 {
+		p.Commit(on)
+		time.Sleep(time.Duration(rand.IntN(500)) * time.Microsecond)
+		p.Commit(off)
+		time.Sleep(time.Duration(rand.IntN(500)) * time.Microsecond)
+	}
+	after := settle()
+	lit := after[0] - before[0]
+	if lit == 0 {
+		t.Fatal("D0 never lit")
+	}
+	for i := range after {
+		if n := after[i] - before[i]; n != lit {
+			t.Errorf("D%d lit %d times, D0 %d times", i, n, lit)
+		}
+	}
+}
+
+func TestShowSceneAfterRestart(t *testing.T) {
+	p, _ := startPanel(t)
+	var s pidp11.Scene
+	s.SetLed(pidp11.LED_RUN, 1, pidp11.NewSimpleEffect(0, 0))
+	if err := p.ShowScene(context.Background(), &s, pidp11.Transition{Kind: pidp11.Cut}); err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	if state := p.CaptureScene().Led(pidp11.LED_RUN); state.Effect != nil {
+		t.Errorf("RUN after stop: %+v", state)
+	}
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.ShowScene(context.Background(), &s, pidp11.Transition{Kind: pidp11.Cut}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, "RUN lit after restart", func() bool {
+		return p.Brightness(pidp11.LED_RUN) == 1
+	})
+}
+
+// Effect recording the resolution of the envelopes.
+type resolutionEffect struct{ resolution *time.Duration }
+
+func (fx resolutionEffect) MakeEnvelope(env *pidp11.Envelope, bright float64, params ...float64) {
+	*fx.resolution = env.Resolution()
+	env.AddStage(env.Current(), bright, 0, true)
+}
+
+func TestLedsBeforeStart(t *testing.T) {
+	mem := pidp11.NewMemBackend()
+	p := pidp11.NewPanel(
+		pidp11.WithBackend(mem),
+		pidp11.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	var s pidp11.Scene
+	s.SetLed(pidp11.LED_USER, 1, pidp11.NewSimpleEffect(0, 0))
+	if err := p.ShowScene(context.Background(), &s, pidp11.Transition{Kind: pidp11.Crossfade, Ms: 10}); err != nil {
+		t.Fatal(err)
+	}
+	var resolution time.Duration
+	p.Led(pidp11.LED_KERNEL, 1, resolutionEffect{&resolution})
+	if resolution <= 0 {
+		t.Errorf("resolution %v before start", resolution)
+	}
+	p.Led(pidp11.LED_RUN, 1, pidp11.NewSimpleEffect(50, 0))
+	f := pidp11.NewFrame()
+	f.Led(pidp11.LED_PAUSE, 1, pidp11.NewSimpleEffect(0, 0))
+	p.Commit(f)
+	if err := p.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	for _, id := range []pidp11.LedID{pidp11.LED_RUN, pidp11.LED_PAUSE, pidp11.LED_USER, pidp11.LED_KERNEL} {
+		eventually(t, pidp11.LedName(id)+" lit", func() bool {
+			return p.Brightness(id) == 1
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package pidp11
+
+import (
+	"slices"
+	"time"
+)
+
+// A combination of switches: emits a KindChord event when the trigger
+// switch is pressed (or turned, for the knobs) while the other switches
+// are on, ie held for the momentary switches or in the given position for
+// the toggles, eg SS_HALT.
+type Chord struct {
+	Name     string
+	Held     []SwitchID
+	Trigger  SwitchID
+	Suppress bool // don't emit the event of the trigger switch
+}
+
+// An ordered sequence of switch presses (or knob turns): emits a
+// KindSequence event when the switches are pressed in order, with no other
+// switch pressed in between, the whole sequence taking no longer than
+// Within.
+// If Suppress is true, the events are held back while the sequence is in
+// progress, and the presses of the sequence dropped if it completes, the
+// other events being then delivered.
+type Sequence struct {
+	Name     string
+	Switches []SwitchID
+	Within   time.Duration
+	Suppress bool
+}
+
+type sequenceState struct {
+	Sequence
+	progress int // number of switches matched
+	start    time.Time
+	matched  []Event // the presses matched so far
+}
+
+type recognizer struct {
+	chords    []Chord
+	sequences []*sequenceState
+	pending   []Event // held back by suppressing sequences in progress
+}
+
+// Registers a chord, replacing any chord or sequence with the same name.
+func (p *Panel) AddChord(chord Chord) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recognizer.remove(chord.Name)
+	p.recognizer.chords = append(p.recognizer.chords, chord)
+}
+
+// Registers a sequence, replacing any chord or sequence with the same
+// name.
+func (p *Panel) AddSequence(seq Sequence) {
+	assert(len(seq.Switches) > 0, "empty sequence %s", seq.Name)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recognizer.remove(seq.Name)
+	p.recognizer.sequences = append(p.recognizer.sequences, &sequenceState{Sequence: seq})
+}
+
+// Unregisters the chord or sequence with the given name.
+func (p *Panel) RemoveGesture(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.recognizer.remove(name)
+}
+
+func (r *recognizer) remove(name string) {
+	chords := r.chords[:0]
+	for _, chord := range r.chords {
+		if chord.Name != name {
+			chords = append(chords, chord)
+		}
+	}
+	r.chords = chords
+	sequences := r.sequences[:0]
+	for _, seq := range r.sequences {
+		if seq.Name != name {
+			sequences = append(sequences, seq)
+		}
+	}
+	r.sequences = sequences
+}
+
+// Presses and knob turns are the events which can be part of gestures.
+func isPress(evt Event) bool {
+	return evt.Kind == KindChange && (evt.On || evt.ID == SS_KNOBA || evt.ID == SS_KNOBD)
+}
+
+// Appends the events resulting from the given event: the event itself,
+// unless suppressed or held back, and then the gestures it completes.
+// Must be called with the panel mutex held.
+func (p *Panel) recognize(evts []Event, evt Event) []Event {
+	r := &p.recognizer
+	if !isPress(evt) {
+		return r.release(evts, evt)
+	}
+	suppressed := false
+	var gestures []Event
+	for _, chord := range r.chords {
+		if chord.Trigger != evt.ID || !p.allOn(chord.Held) {
+			continue
+		}
+		gestures = append(gestures, gestureEvent(evt, KindChord, chord.Name))
+		suppressed = suppressed || chord.Suppress
+	}
+	for _, seq := range r.sequences {
+		if !seq.advance(evt) {
+			continue
+		}
+		if seq.Suppress {
+			r.drop(seq.matched)
+			suppressed = true
+		}
+		gestures = append(gestures, gestureEvent(evt, KindSequence, seq.Name))
+	}
+	if suppressed {
+		evts = r.release(evts, Event{})
+	} else {
+		evts = r.release(evts, evt)
+	}
+	return append(evts, gestures...)
+}
+
+// Appends the event, or holds it back if a suppressing sequence is in
+// progress, in which case it is appended with the previously held back
+// events once the sequence is broken.
+func (r *recognizer) release(evts []Event, evt Event) []Event {
+	if evt.ID != SS_NIL {
+		r.pending = append(r.pending, evt)
+	}
+	for _, seq := range r.sequences {
+		if seq.Suppress && seq.progress > 0 {
+			return evts
+		}
+	}
+	evts = append(evts, r.pending...)
+	r.pending = r.pending[:0]
+	return evts
+}
+
+// Removes the given events from the held back ones.
+func (r *recognizer) drop(evts []Event) {
+	pending := r.pending[:0]
+	for _, evt := range r.pending {
+		if !slices.Contains(evts, evt) {
+			pending = append(pending, evt)
+		}
+	}
+	r.pending = pending
+}
+
+// Appends the events held back by the sequences which timed out.
+// Must be called with the panel mutex held.
+func (p *Panel) recognizerTick(evts []Event, now time.Time) []Event {
+	r := &p.recognizer
+	for _, seq := range r.sequences {
+		if seq.progress > 0 && now.Sub(seq.start) > seq.Within {
+			seq.progress = 0
+		}
+	}
+	if len(r.pending) == 0 {
+		return evts
+	}
+	return r.release(evts, Event{})
+}
+
+// Returns true if the sequence is complete.
+func (seq *sequenceState) advance(evt Event) bool {
+	if seq.progress > 0 && evt.Time.Sub(seq.start) > seq.Within {
+		seq.progress = 0
+	}
+	if evt.ID != seq.Switches[seq.progress] {
+		seq.progress = 0
+		if evt.ID != seq.Switches[0] {
+			return false
+		}
+	}
+	if seq.progress == 0 {
+		seq.start = evt.Time
+		seq.matched = seq.matched[:0]
+	}
+	seq.progress++
+	seq.matched = append(seq.matched, evt)
+	if seq.progress < len(seq.Switches) {
+		return false
+	}
+	seq.progress = 0
+	return true
+}
+
+func gestureEvent(evt Event, kind EventKind, name string) Event {
+	evt.Kind = kind
+	evt.Name = name
+	return evt
+}
+
+func (p *Panel) allOn(ids []SwitchID) bool {
+	for _, id := range ids {
+		if !p.switchState(id) {
+			return false
+		}
+	}
+	return true
+}
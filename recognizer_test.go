@@ -0,0 +1,70 @@
+package pidp11
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSuppressedSequenceKeepsOtherEvents(t *testing.T) {
+	p := NewPanel(WithBackend(NewMemBackend()))
+	p.AddSequence(Sequence{
+		Name:     "exam-exam-dep",
+		Switches: []SwitchID{SS_EXAM, SS_EXAM, SS_DEP},
+		Within:   time.Second,
+		Suppress: true,
+	})
+	now := time.Now()
+	var evts []Event
+	p.mu.Lock()
+	for i, evt := range []Event{
+		{ID: SS_EXAM, On: true},
+		{ID: SS_SR3, On: false},
+		{ID: SS_EXAM, On: true},
+		{ID: SS_REGISTER, Kind: KindRegister, Value: 1, Previous: 9},
+		{ID: SS_DEP, On: true},
+	} {
+		evt.Time = now.Add(time.Duration(i) * time.Millisecond)
+		evts = p.recognize(evts, evt)
+	}
+	p.mu.Unlock()
+
+	checkEvents(t, evts, "SR3/change", "REGISTER/register", "DEP/sequence")
+}
+
+func TestGesturesAfterTrigger(t *testing.T) {
+	p := NewPanel(WithBackend(NewMemBackend()))
+	p.AddChord(Chord{Name: "halt-start", Held: []SwitchID{SS_HALT}, Trigger: SS_START})
+	p.AddSequence(Sequence{
+		Name:     "start-start",
+		Switches: []SwitchID{SS_START, SS_START},
+		Within:   time.Second,
+	})
+	now := time.Now()
+	var evts []Event
+	p.mu.Lock()
+	p.switches[swENABLE] = true // HALT
+	for i, evt := range []Event{
+		{ID: SS_START, On: true},
+		{ID: SS_START, On: false},
+		{ID: SS_START, On: true},
+	} {
+		evt.Time = now.Add(time.Duration(i) * time.Millisecond)
+		evts = p.recognize(evts, evt)
+	}
+	p.mu.Unlock()
+	checkEvents(t, evts,
+		"START/change", "START/chord", "START/change",
+		"START/change", "START/chord", "START/sequence")
+}
+
+func checkEvents(t *testing.T, evts []Event, want ...string) {
+	t.Helper()
+	var got []string
+	for _, evt := range evts {
+		got = append(got, evt.SwitchName()+"/"+evt.Kind.String())
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,77 @@
+package pidp11
+
+import (
+	"strings"
+	"time"
+)
+
+// Coalesces the changes of the register switches: when the switches have
+// been stable for the settle window, a KindRegister event is emitted with
+// the old and new values.
+type registerTracker struct {
+	settle  time.Duration // 0 if disabled
+	value   uint          // last reported value
+	changed time.Time     // last change of a register switch
+	pending bool          // changed since the last report
+}
+
+// Records the change of a register switch.
+func (r *registerTracker) update(now time.Time) {
+	r.changed = now
+	r.pending = true
+}
+
+// Returns the KindRegister event if the switches have settled on a new
+// value.
+func (r *registerTracker) tick(now time.Time, value uint) []Event {
+	if r.settle == 0 || !r.pending || now.Sub(r.changed) < r.settle {
+		return nil
+	}
+	r.pending = false
+	if value == r.value {
+		return nil
+	}
+	evt := Event{ID: SS_REGISTER, On: true, Kind: KindRegister, Value: value, Previous: r.value}
+	r.value = value
+	return []Event{evt}
+}
+
+// Returns the octal digits of the value, most significant first, as
+// grouped by the colours of the switches on the 11/70, eg 8 digits for the
+// 22 register switches.
+func OctalDigits(val uint, bits int) []uint {
+	n := (bits + 2) / 3
+	digits := make([]uint, n)
+	for i := n - 1; i >= 0; i-- {
+		digits[i] = val & 7
+		val >>= 3
+	}
+	return digits
+}
+
+// Formats the value as zero-padded octal, eg "00017777" for 8191 on 22
+// bits.
+func FormatOctal(val uint, bits int) string {
+	var sb strings.Builder
+	for _, digit := range OctalDigits(val, bits) {
+		sb.WriteByte(byte('0' + digit))
+	}
+	return sb.String()
+}
+
+// Formats the value as the positions of the switches, in groups of 3 as on
+// the 11/70, eg "1 111 111 111 111 111 111 111" for 22 bits all set.
+func FormatSwitchGroups(val uint, bits int) string {
+	var sb strings.Builder
+	for i := bits - 1; i >= 0; i-- {
+		if val&(1<<i) != 0 {
+			sb.WriteByte('1')
+		} else {
+			sb.WriteByte('0')
+		}
+		if i > 0 && i%3 == 0 {
+			sb.WriteByte(' ')
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,307 @@
+package pidp11
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// State of a led as given to Led(), the brightness being before scaling.
+// A led never set has a nil effect, and is off.
+type LedState struct {
+	Brightness float64
+	Effect     Effect
+	Params     []float64
+}
+
+// State of all the leds of the panel, see CaptureScene() and ShowScene().
+// The zero value has all leds off.
+type Scene struct {
+	leds [ledsCount]LedState
+}
+
+// Returns the state of the led in the scene.
+func (s *Scene) Led(id LedID) LedState {
+	return s.leds[id]
+}
+
+// Sets the state of the led in the scene, as Led() would.
+func (s *Scene) SetLed(id LedID, brightP float64, fx Effect, fxParams ...float64) {
+	s.leds[id] = LedState{brightP, fx, cloneParams(fxParams)}
+}
+
+// Copies the params, nil if empty so that the states can be compared.
+func cloneParams(params []float64) []float64 {
+	if len(params) == 0 {
+		return nil
+	}
+	return slices.Clone(params)
+}
+
+// Returns the state of all the leds, as last set by Led() or Commit().
+// The states are forgotten when the panel stops.
+func (p *Panel) CaptureScene() *Scene {
+	s := &Scene{}
+	for id := range s.leds {
+		spec := &p.ledSpecs[id]
+		spec.Lock()
+		s.leds[id] = spec.state
+		spec.Unlock()
+	}
+	return s
+}
+
+type TransitionKind int
+
+const (
+	Cut       TransitionKind = iota // all leds at once
+	Crossfade                       // ramping the brightness of all leds
+	Wipe                            // column by column from left to right across the address row
+	Dissolve                        // led by led in random order
+)
+
+var transitionKindNames = []string{"cut", "crossfade", "wipe", "dissolve"}
+
+func (kind TransitionKind) String() string {
+	if kind < 0 || int(kind) >= len(transitionKindNames) {
+		return fmt.Sprintf("TransitionKind(%d)", kind)
+	}
+	return transitionKindNames[kind]
+}
+
+// How ShowScene() switches to a scene, over Ms milliseconds.
+type Transition struct {
+	Kind TransitionKind
+	Ms   int
+}
+
+// Parses a transition given as its kind optionally followed by its
+// duration in ms, eg "cut" or "crossfade:500".
+func ParseTransition(spec string) (Transition, error) {
+	name, msSpec, hasMs := strings.Cut(spec, ":")
+	var t Transition
+	kind := slices.Index(transitionKindNames, name)
+	if kind < 0 {
+		return t, fmt.Errorf("unknown transition: %s", name)
+	}
+	t.Kind = TransitionKind(kind)
+	if hasMs {
+		ms, err := strconv.Atoi(msSpec)
+		if err != nil || ms < 0 {
+			return t, fmt.Errorf("invalid transition duration: %q", msSpec)
+		}
+		t.Ms = ms
+	}
+	return t, nil
+}
+
+// Switches to the scene with the given transition, returning when it is
+// complete or the context is done. The leds whose state doesn't change
+// are left untouched, as are the indicators of the knob selectors.
+// For the crossfades, the leds are ramped to the brightness of their new
+// state before switching to its effect.
+// For the wipes, the data leds switch with the address leds of the same
+// bit, and the other leds with the last column.
+func (p *Panel) ShowScene(ctx context.Context, s *Scene, t Transition) error {
+	var changed []LedID
+	for id, state := range s.leds {
+		spec := &p.ledSpecs[id]
+		spec.Lock()
+		same := reflect.DeepEqual(spec.state, state)
+		spec.Unlock()
+		if !same && !strings.HasPrefix(LedName(LedID(id)), "UNUSED") && !p.isSelectorLed(LedID(id)) {
+			changed = append(changed, LedID(id))
+		}
+	}
+	p.logger.Debug("ShowScene", "transition", t.Kind, "ms", t.Ms, "leds", len(changed))
+	frame := func(ids []LedID, via Effect) *Frame {
+		f := NewFrame()
+		for _, id := range ids {
+			state := s.leds[id]
+			if state.Effect == nil {
+				state = LedState{0, NewSimpleEffect(0, 0), nil}
+			}
+			f.leds = append(f.leds, frameLed{id: id, state: state, via: via})
+		}
+		return f
+	}
+	// Groups of leds switched in sequence, over the duration
+	var steps [][]LedID
+	switch t.Kind {
+	case Cut:
+		p.Commit(frame(changed, nil))
+		return nil
+	case Crossfade:
+		p.Commit(frame(changed, fadeEffect{t.Ms}))
+		if err := sleepCtx(ctx, time.Duration(t.Ms)*time.Millisecond); err != nil {
+			return err
+		}
+		p.Commit(frame(changed, nil))
+		return nil
+	case Wipe:
+		steps = make([][]LedID, 22)
+		for _, id := range changed {
+			col := len(steps) - 1
+			name := LedName(id)
+			if bit, err := strconv.Atoi(name[1:]); err == nil && (name[0] == 'A' || name[0] == 'D') {
+				col = 21 - bit
+			}
+			steps[col] = append(steps[col], id)
+		}
+	case Dissolve:
+		rand.Shuffle(len(changed), func(i, j int) {
+			changed[i], changed[j] = changed[j], changed[i]
+		})
+		for _, id := range changed {
+			steps = append(steps, []LedID{id})
+		}
+	default:
+		return fmt.Errorf("invalid transition: %d", t.Kind)
+	}
+	start := time.Now()
+	for i, ids := range steps {
+		if len(steps) > 1 {
+			at := start.Add(time.Duration(t.Ms*i/(len(steps)-1)) * time.Millisecond)
+			if err := sleepCtx(ctx, time.Until(at)); err != nil {
+				return err
+			}
+		}
+		p.Commit(frame(ids, nil))
+	}
+	return nil
+}
+
+// Linear ramp to the brightness over the duration, for crossfades.
+type fadeEffect struct {
+	ms int
+}
+
+func (fx fadeEffect) MakeEnvelope(env *Envelope, bright float64, fxParams ...float64) {
+	env.AddStage(env.Current(), bright, fx.ms, true)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// Scenes by name, stored as JSON.
+type Scenes map[string]*Scene
+
+func LoadScenes(path string) (Scenes, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var scenes Scenes
+	if err := json.Unmarshal(data, &scenes); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for name, scene := range scenes {
+		if scene == nil {
+			return nil, fmt.Errorf("%s: scene %s: null", path, name)
+		}
+	}
+	return scenes, nil
+}
+
+// Fails if a scene has effects which can't be encoded, see
+// Scene.MarshalJSON().
+func (scenes Scenes) Save(path string) error {
+	data, err := json.MarshalIndent(scenes, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+type ledStateJSON struct {
+	Brightness float64   `json:"brightness"`
+	Effect     string    `json:"effect"`
+	Params     []float64 `json:"params,omitempty"`
+}
+
+// Encodes the scene as an object with the leds by name, the leds never
+// set being omitted. The effects are given as for ParseEffect(), so only
+// the effects created by NewEffectByName() can be encoded: a scene with
+// any other effect, eg a custom Effect implementation, fails to encode.
+func (s *Scene) MarshalJSON() ([]byte, error) {
+	leds := map[string]ledStateJSON{}
+	for id, state := range s.leds {
+		if state.Effect == nil {
+			continue
+		}
+		spec, err := effectSpec(state.Effect)
+		if err != nil {
+			return nil, err
+		}
+		leds[LedName(LedID(id))] = ledStateJSON{state.Brightness, spec, state.Params}
+	}
+	return json.Marshal(leds)
+}
+
+func (s *Scene) UnmarshalJSON(data []byte) error {
+	var leds map[string]ledStateJSON
+	if err := json.Unmarshal(data, &leds); err != nil {
+		return err
+	}
+	*s = Scene{}
+	for name, state := range leds {
+		id, ok := LookupLed(name)
+		if !ok {
+			return fmt.Errorf("unknown led: %s", name)
+		}
+		fx, count, err := ParseEffect(state.Effect)
+		if err != nil {
+			return fmt.Errorf("led %s: %w", name, err)
+		}
+		if !(state.Brightness >= 0 && state.Brightness <= 1) {
+			return fmt.Errorf("led %s: brightness %v not in [0, 1]", name, state.Brightness)
+		}
+		if len(state.Params) != count {
+			return fmt.Errorf("led %s: effect %s takes %d params", name, state.Effect, count)
+		}
+		if err := CheckParams(state.Params...); err != nil {
+			return fmt.Errorf("led %s: %w", name, err)
+		}
+		s.leds[id] = LedState{state.Brightness, fx, state.Params}
+	}
+	return nil
+}
+
+// Returns the effect as given to ParseEffect().
+func effectSpec(fx Effect) (string, error) {
+	withArgs := func(name string, onMs, offMs int) string {
+		if onMs == 0 && offMs == 0 {
+			return name
+		}
+		return fmt.Sprintf("%s:%d,%d", name, onMs, offMs)
+	}
+	switch fx := fx.(type) {
+	case SimpleEffect:
+		return withArgs("simple", fx.onMs, fx.offMs), nil
+	case FlashEffect:
+		return withArgs("flash", fx.onMs, fx.offMs), nil
+	case StrobeEffect:
+		return withArgs("strobe", fx.onMs, fx.offMs), nil
+	case ErrorEffect:
+		return "error", nil
+	}
+	return "", fmt.Errorf("effect %T cannot be encoded", fx)
+}
@@ -0,0 +1,77 @@
+package pidp11
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSceneJSON(t *testing.T) {
+	var s Scene
+	s.SetLed(LED_RUN, 1, NewFlashEffect(100, 100), .5)
+	s.SetLed(LED_A3, .25, NewSimpleEffect(0, 0))
+	data, err := json.Marshal(&s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Scene
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, s) {
+		t.Errorf("decoded %s as %+v", data, decoded)
+	}
+}
+
+func TestSceneJSONErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"RUN": {"brightness": 1.5, "effect": "simple"}}`,
+		`{"RUN": {"brightness": -0.5, "effect": "simple"}}`,
+		`{"RUN": {"brightness": 1, "effect": "flash", "params": [2]}}`,
+		`{"RUN": {"brightness": 1, "effect": "flash"}}`,
+		`{"RUN": {"brightness": 1, "effect": "flash:-1,0", "params": [0.5]}}`,
+		`{"RUN": {"brightness": 1, "effect": "sparkle"}}`,
+		`{"NOPE": {"brightness": 1, "effect": "simple"}}`,
+	} {
+		var s Scene
+		if err := json.Unmarshal([]byte(data), &s); err == nil {
+			t.Errorf("%s: no error", data)
+		}
+	}
+
+	// Custom effects can't be encoded
+	var s Scene
+	s.SetLed(LED_RUN, 1, customEffect{})
+	if _, err := json.Marshal(&s); err == nil || !strings.Contains(err.Error(), "cannot be encoded") {
+		t.Errorf("custom effect encoded, err %v", err)
+	}
+}
+
+func TestLoadScenesNull(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenes.json")
+	if err := os.WriteFile(path, []byte(`{"x": null}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadScenes(path); err == nil || !strings.Contains(err.Error(), "scene x") {
+		t.Errorf("null scene loaded, err %v", err)
+	}
+}
+
+func TestTransitionKindString(t *testing.T) {
+	for kind, want := range map[TransitionKind]string{
+		Dissolve: "dissolve", -1: "TransitionKind(-1)", 4: "TransitionKind(4)",
+	} {
+		if kind.String() != want {
+			t.Errorf("got %q, want %q", kind.String(), want)
+		}
+	}
+}
+
+type customEffect struct{}
+
+func (customEffect) MakeEnvelope(env *Envelope, bright float64, params ...float64) {
+	env.AddStage(env.Current(), bright, 0, true)
+}
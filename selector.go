@@ -0,0 +1,122 @@
+package pidp11
+
+import (
+	"slices"
+	"sync"
+)
+
+// The address and data knobs of the 11/70 select what is shown on the
+// address and data leds, the selection being indicated by a led.
+// When enabled with WithKnobSelectors(), the knob rotations move the
+// selections, with wrap-around, and KindSelect events are emitted.
+
+// Positions of the address knob, clockwise
+var addressSelections = []LedID{
+	LED_USER_D, LED_USER_I, LED_SUPER_I, LED_KERNEL_I,
+	LED_PROG_PHY, LED_CONS_PHY, LED_KERNEL_D, LED_SUPER_D,
+}
+
+// Positions of the data knob, clockwise
+var dataSelections = []LedID{
+	LED_DATA_PATHS, LED_μADR_FPP_CPU, LED_DISPLAY_REGISTER, LED_BUS_REG,
+}
+
+type selector struct {
+	knob SwitchID
+	leds []LedID
+	pos  int
+}
+
+type selectors struct {
+	sync.Mutex
+	enabled bool
+	address selector
+	data    selector
+}
+
+func newSelectors() selectors {
+	return selectors{
+		address: selector{knob: SS_KNOBA, leds: addressSelections, pos: 4}, // PROG_PHY
+		data:    selector{knob: SS_KNOBD, leds: dataSelections},
+	}
+}
+
+// Returns the indicator led of the position of the address knob.
+func (p *Panel) AddressSelection() LedID {
+	p.selectors.Lock()
+	defer p.selectors.Unlock()
+	return p.selectors.address.selected()
+}
+
+// Returns the indicator led of the position of the data knob.
+func (p *Panel) DataSelection() LedID {
+	p.selectors.Lock()
+	defer p.selectors.Unlock()
+	return p.selectors.data.selected()
+}
+
+func (sel *selector) selected() LedID {
+	return sel.leds[sel.pos]
+}
+
+// Returns true if the led is a selection indicator, and the selectors are
+// enabled, in which case it is left alone by ClearLeds() and ShowScene().
+func (p *Panel) isSelectorLed(id LedID) bool {
+	p.selectors.Lock()
+	defer p.selectors.Unlock()
+	return p.selectors.enabled &&
+		(slices.Contains(addressSelections, id) || slices.Contains(dataSelections, id))
+}
+
+// Lights the indicators of the selections, if enabled.
+func (p *Panel) lightSelectors() {
+	p.selectors.Lock()
+	defer p.selectors.Unlock()
+	if !p.selectors.enabled {
+		return
+	}
+	f := NewFrame()
+	for _, sel := range []*selector{&p.selectors.address, &p.selectors.data} {
+		for _, id := range sel.leds {
+			f.showBit(id, id == sel.selected(), NewSimpleEffect(0, 0))
+		}
+	}
+	p.Commit(f)
+}
+
+// Moves the selections according to the knob events, and appends the
+// KindSelect events.
+// Must be called without the panel mutex held, as it sets leds.
+func (p *Panel) selectKnobs(evts []Event) []Event {
+	p.selectors.Lock()
+	defer p.selectors.Unlock()
+	if !p.selectors.enabled {
+		return evts
+	}
+	for _, evt := range evts {
+		if evt.Kind != KindChange || evt.Delta == 0 ||
+			(evt.ID != SS_KNOBA && evt.ID != SS_KNOBD) {
+			continue
+		}
+		sel := &p.selectors.address
+		if evt.ID == SS_KNOBD {
+			sel = &p.selectors.data
+		}
+		old := sel.selected()
+		n := len(sel.leds)
+		sel.pos = ((sel.pos+evt.Delta)%n + n) % n
+		selected := sel.selected()
+		if selected == old {
+			continue
+		}
+		f := NewFrame()
+		f.showBit(old, false, NewSimpleEffect(0, 0))
+		f.showBit(selected, true, NewSimpleEffect(0, 0))
+		p.Commit(f)
+		evt.Kind = KindSelect
+		evt.Name = LedName(selected)
+		evt.Value = uint(sel.pos)
+		evts = append(evts, evt)
+	}
+	return evts
+}
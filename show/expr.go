@@ -0,0 +1,42 @@
+package show
+
+// Numeric expression, evaluated when the statement runs.
+type expr func(r *runner) float64
+
+func constExpr(val float64) expr {
+	return func(*runner) float64 {
+		return val
+	}
+}
+
+func varExpr(name string) expr {
+	return func(r *runner) float64 {
+		return r.vars[name]
+	}
+}
+
+// Value of the register switches lo to hi.
+func srExpr(lo, hi int) expr {
+	return func(r *runner) float64 {
+		val := r.panel.ReadRegSwitches() >> lo
+		return float64(val & (1<<(hi-lo+1) - 1))
+	}
+}
+
+func binaryExpr(left, right expr, op rune) expr {
+	return func(r *runner) float64 {
+		a, b := left(r), right(r)
+		switch op {
+		case '+':
+			return a + b
+		case '-':
+			return a - b
+		case '*':
+			return a * b
+		}
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	}
+}
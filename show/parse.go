@@ -0,0 +1,478 @@
+// Package show plays light shows written in a small line-based language,
+// so that they can be authored without writing Go:
+//
+//	# Comments start with a hash
+//	group lamps RUN,PAUSE,MASTER
+//	led A0..A21 1 flash(250,250) 0.3   # leds, brightness, effect, params
+//	at 1.5s led lamps 1                  # 1.5s after the start of the block
+//	wait 500ms
+//	on START                             # wait for the switch
+//	let speed = sr[0..3]/15              # read from the register switches
+//	repeat 3                             # or forever without a count
+//	    led D0..D15 1 strobe speed
+//	    wait 1s
+//	    clear 200ms
+//	end
+//	brightness 0.5                       # see SetBrightnessAdjust()
+//
+// The leds are given as a comma-separated list of led names, ranges of
+// leds such as A21..A0, group names, or "all". The effects are given by
+// their name optionally followed by the arguments of their constructor,
+// see pidp11.NewEffectByName(), "simple" by default.
+//
+// The numbers can be computed from variables with the operators + - * /,
+// evaluated from left to right and without spaces. The variable sr is the
+// value of the register switches when evaluated, and sr[lo..hi] or sr[n]
+// the value of some of them. The durations are in ms, and can also be
+// given as a number followed by "ms" or "s", eg 1.5s.
+//
+// The times given to "at" are relative to the start of the show, of the
+// current iteration of a repeat, or of the last "on", whichever is latest.
+package show
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/perpen/pidp11"
+)
+
+// Error in a script, with the number of its line starting from 1.
+type SyntaxError struct {
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// A parsed script.
+type Show struct {
+	stmts []stmt
+}
+
+type stmt interface {
+	line() int
+}
+
+type ledStmt struct {
+	lineNum    int
+	leds       []pidp11.LedID
+	brightness expr
+	effect     string
+	effectArgs []expr
+	params     []expr
+}
+
+type atStmt struct {
+	lineNum int
+	delay   expr // ms
+	stmt    stmt
+}
+
+type waitStmt struct {
+	lineNum int
+	delay   expr // ms
+}
+
+type onStmt struct {
+	lineNum int
+	id      pidp11.SwitchID
+}
+
+type clearStmt struct {
+	lineNum int
+	offMs   expr
+}
+
+type brightnessStmt struct {
+	lineNum int
+	adjust  expr
+}
+
+type letStmt struct {
+	lineNum int
+	name    string
+	val     expr
+}
+
+type repeatStmt struct {
+	lineNum int
+	count   expr // nil to repeat forever
+	body    []stmt
+}
+
+func (s *ledStmt) line() int        { return s.lineNum }
+func (s *atStmt) line() int         { return s.lineNum }
+func (s *waitStmt) line() int       { return s.lineNum }
+func (s *onStmt) line() int         { return s.lineNum }
+func (s *clearStmt) line() int      { return s.lineNum }
+func (s *brightnessStmt) line() int { return s.lineNum }
+func (s *letStmt) line() int        { return s.lineNum }
+func (s *repeatStmt) line() int     { return s.lineNum }
+
+type parser struct {
+	lineNum int
+	groups  map[string][]pidp11.LedID
+	vars    map[string]bool
+}
+
+func ParseFile(path string) (*Show, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Parse(f)
+}
+
+// Parses a script, returning a *SyntaxError for the first error found.
+func Parse(r io.Reader) (*Show, error) {
+	p := &parser{
+		groups: map[string][]pidp11.LedID{},
+		vars:   map[string]bool{"sr": true},
+	}
+	// Blocks being parsed, the innermost last
+	blocks := []*repeatStmt{{}}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		p.lineNum++
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		block := blocks[len(blocks)-1]
+		switch words[0] {
+		case "end":
+			if len(words) != 1 {
+				return nil, p.errorf("unexpected arguments to end")
+			}
+			if len(blocks) == 1 {
+				return nil, p.errorf("end without repeat")
+			}
+			blocks = blocks[:len(blocks)-1]
+		case "repeat":
+			s := &repeatStmt{lineNum: p.lineNum}
+			switch len(words) {
+			case 1:
+			case 2:
+				var err error
+				if s.count, err = p.parseExpr(words[1]); err != nil {
+					return nil, err
+				}
+			default:
+				return nil, p.errorf("usage: repeat [<count>]")
+			}
+			block.body = append(block.body, s)
+			blocks = append(blocks, s)
+		case "group":
+			if len(words) < 3 {
+				return nil, p.errorf("usage: group <name> <leds>...")
+			}
+			if !isIdent(words[1]) || words[1] == "all" {
+				return nil, p.errorf("invalid group name: %s", words[1])
+			}
+			if _, ok := pidp11.LookupLed(words[1]); ok {
+				return nil, p.errorf("group name is a led: %s", words[1])
+			}
+			var leds []pidp11.LedID
+			for _, word := range words[2:] {
+				ids, err := p.parseLeds(word)
+				if err != nil {
+					return nil, err
+				}
+				leds = append(leds, ids...)
+			}
+			p.groups[words[1]] = leds
+		default:
+			s, err := p.parseStmt(words)
+			if err != nil {
+				return nil, err
+			}
+			block.body = append(block.body, s)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(blocks) > 1 {
+		p.lineNum = blocks[len(blocks)-1].lineNum
+		return nil, p.errorf("repeat without end")
+	}
+	return &Show{stmts: blocks[0].body}, nil
+}
+
+func (p *parser) parseStmt(words []string) (stmt, error) {
+	args := words[1:]
+	var err error
+	switch words[0] {
+	case "led":
+		return p.parseLed(args)
+	case "at":
+		if len(args) < 2 {
+			return nil, p.errorf("usage: at <time> <statement>")
+		}
+		s := &atStmt{lineNum: p.lineNum}
+		if s.delay, err = p.parseDuration(args[0]); err != nil {
+			return nil, err
+		}
+		if args[1] == "at" {
+			return nil, p.errorf("nested at")
+		}
+		if s.stmt, err = p.parseStmt(args[1:]); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "wait":
+		if len(args) != 1 {
+			return nil, p.errorf("usage: wait <duration>")
+		}
+		s := &waitStmt{lineNum: p.lineNum}
+		if s.delay, err = p.parseDuration(args[0]); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "on":
+		if len(args) != 1 {
+			return nil, p.errorf("usage: on <switch>")
+		}
+		id, ok := pidp11.LookupSwitch(args[0])
+		if !ok {
+			return nil, p.errorf("unknown switch: %s", args[0])
+		}
+		return &onStmt{lineNum: p.lineNum, id: id}, nil
+	case "clear":
+		s := &clearStmt{lineNum: p.lineNum, offMs: constExpr(0)}
+		switch len(args) {
+		case 0:
+		case 1:
+			if s.offMs, err = p.parseDuration(args[0]); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.errorf("usage: clear [<duration>]")
+		}
+		return s, nil
+	case "brightness":
+		if len(args) != 1 {
+			return nil, p.errorf("usage: brightness <adjust>")
+		}
+		s := &brightnessStmt{lineNum: p.lineNum}
+		if s.adjust, err = p.parseExpr(args[0]); err != nil {
+			return nil, err
+		}
+		return s, nil
+	case "let":
+		if len(args) != 3 || args[1] != "=" {
+			return nil, p.errorf("usage: let <name> = <value>")
+		}
+		if !isIdent(args[0]) || args[0] == "sr" {
+			return nil, p.errorf("invalid variable name: %s", args[0])
+		}
+		s := &letStmt{lineNum: p.lineNum, name: args[0]}
+		if s.val, err = p.parseExpr(args[2]); err != nil {
+			return nil, err
+		}
+		p.vars[s.name] = true
+		return s, nil
+	case "end", "repeat", "group":
+		return nil, p.errorf("%s not allowed here", words[0])
+	}
+	return nil, p.errorf("unknown statement: %s", words[0])
+}
+
+func (p *parser) parseLed(args []string) (stmt, error) {
+	if len(args) < 2 {
+		return nil, p.errorf("usage: led <leds> <brightness> [<effect> [<param>...]]")
+	}
+	s := &ledStmt{lineNum: p.lineNum, effect: "simple"}
+	var err error
+	if s.leds, err = p.parseLeds(args[0]); err != nil {
+		return nil, err
+	}
+	if s.brightness, err = p.parseExpr(args[1]); err != nil {
+		return nil, err
+	}
+	if len(args) > 2 {
+		name, argsSpec, hasArgs := strings.Cut(args[2], "(")
+		s.effect = name
+		if hasArgs {
+			argsSpec, ok := strings.CutSuffix(argsSpec, ")")
+			if !ok {
+				return nil, p.errorf("missing ) in effect: %s", args[2])
+			}
+			for _, arg := range strings.Split(argsSpec, ",") {
+				e, err := p.parseExpr(arg)
+				if err != nil {
+					return nil, err
+				}
+				s.effectArgs = append(s.effectArgs, e)
+			}
+		}
+	}
+	// Check the effect with dummy arguments
+	_, count, err := pidp11.NewEffectByName(s.effect, make([]int, len(s.effectArgs))...)
+	if err != nil {
+		return nil, p.errorf("%s", err)
+	}
+	for _, arg := range args[min(len(args), 3):] {
+		e, err := p.parseExpr(arg)
+		if err != nil {
+			return nil, err
+		}
+		s.params = append(s.params, e)
+	}
+	if len(s.params) != count {
+		return nil, p.errorf("effect %s takes %d params, got %d", s.effect, count, len(s.params))
+	}
+	return s, nil
+}
+
+// Parses a comma-separated list of leds, ranges and groups.
+func (p *parser) parseLeds(spec string) ([]pidp11.LedID, error) {
+	var ids []pidp11.LedID
+	for _, item := range strings.Split(spec, ",") {
+		if item == "all" {
+			for i, name := range pidp11.LedNames() {
+				if !strings.HasPrefix(name, "UNUSED") {
+					ids = append(ids, pidp11.LedID(i))
+				}
+			}
+			continue
+		}
+		if group, ok := p.groups[item]; ok {
+			ids = append(ids, group...)
+			continue
+		}
+		first, last, isRange := strings.Cut(item, "..")
+		from, ok := pidp11.LookupLed(first)
+		if !ok {
+			return nil, p.errorf("unknown led or group: %s", first)
+		}
+		if !isRange {
+			ids = append(ids, from)
+			continue
+		}
+		to, ok := pidp11.LookupLed(last)
+		if !ok {
+			return nil, p.errorf("unknown led: %s", last)
+		}
+		step := pidp11.LedID(1)
+		if to < from {
+			step = -1
+		}
+		for id := from; ; id += step {
+			if !strings.HasPrefix(pidp11.LedName(id), "UNUSED") {
+				ids = append(ids, id)
+			}
+			if id == to {
+				break
+			}
+		}
+	}
+	return ids, nil
+}
+
+// Parses a duration, returning an expression giving it in ms. The units
+// only follow numbers, so that a variable such as "pos" is not taken for
+// "po" seconds.
+func (p *parser) parseDuration(spec string) (expr, error) {
+	e, err := p.parseExpr(spec)
+	if err == nil {
+		return e, nil
+	}
+	for _, unit := range []struct {
+		suffix string
+		ms     float64
+	}{{"ms", 1}, {"s", 1000}} {
+		num, ok := strings.CutSuffix(spec, unit.suffix)
+		if !ok {
+			continue
+		}
+		val, nerr := strconv.ParseFloat(num, 64)
+		if nerr == nil && !math.IsNaN(val) && !math.IsInf(val, 0) {
+			return constExpr(val * unit.ms), nil
+		}
+	}
+	return nil, err
+}
+
+// Parses operands separated by operators, evaluated from left to right.
+func (p *parser) parseExpr(spec string) (expr, error) {
+	var e expr
+	var op rune
+	start := 0
+	for i, c := range spec + "+" {
+		if !strings.ContainsRune("+-*/", c) || i == start {
+			continue
+		}
+		operand, err := p.parseOperand(spec[start:i])
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			e = operand
+		} else {
+			e = binaryExpr(e, operand, op)
+		}
+		op = c
+		start = i + 1
+	}
+	if e == nil || start != len(spec)+1 {
+		return nil, p.errorf("invalid expression: %q", spec)
+	}
+	return e, nil
+}
+
+func (p *parser) parseOperand(spec string) (expr, error) {
+	if val, err := strconv.ParseFloat(spec, 64); err == nil {
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return nil, p.errorf("invalid number: %s", spec)
+		}
+		return constExpr(val), nil
+	}
+	if bits, ok := strings.CutPrefix(spec, "sr["); ok {
+		bits, ok := strings.CutSuffix(bits, "]")
+		lo, hi, isRange := strings.Cut(bits, "..")
+		if !isRange {
+			hi = lo
+		}
+		loBit, err1 := strconv.Atoi(lo)
+		hiBit, err2 := strconv.Atoi(hi)
+		if !ok || err1 != nil || err2 != nil || loBit < 0 || hiBit > 21 || loBit > hiBit {
+			return nil, p.errorf("invalid register switches: %s", spec)
+		}
+		return srExpr(loBit, hiBit), nil
+	}
+	if !isIdent(spec) {
+		return nil, p.errorf("invalid operand: %q", spec)
+	}
+	if !p.vars[spec] {
+		return nil, p.errorf("undefined variable: %s", spec)
+	}
+	if spec == "sr" {
+		return srExpr(0, 21), nil
+	}
+	return varExpr(spec), nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return &SyntaxError{Line: p.lineNum, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isIdent(s string) bool {
+	for i, c := range s {
+		if !(c == '_' || unicode.IsLetter(c) || i > 0 && unicode.IsDigit(c)) {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,164 @@
+package show
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+type runner struct {
+	panel *pidp11.Panel
+	vars  map[string]float64
+}
+
+// Reference for the times given to "at".
+type block struct {
+	start time.Time
+}
+
+// Error occurring while playing a show, eg an invalid brightness.
+type RunError struct {
+	Line int
+	Err  error
+}
+
+func (e *RunError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// Plays the show on the panel, until its end or the context is done.
+func (s *Show) Run(ctx context.Context, panel *pidp11.Panel) error {
+	r := &runner{
+		panel: panel,
+		vars:  map[string]float64{},
+	}
+	return r.run(ctx, s.stmts, &block{start: time.Now()})
+}
+
+func (r *runner) run(ctx context.Context, stmts []stmt, b *block) error {
+	for _, s := range stmts {
+		if err := r.exec(ctx, s, b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *runner) exec(ctx context.Context, s stmt, b *block) error {
+	switch s := s.(type) {
+	case *ledStmt:
+		return r.led(s)
+	case *atStmt:
+		if err := sleep(ctx, time.Until(b.start.Add(r.ms(s.delay)))); err != nil {
+			return err
+		}
+		return r.exec(ctx, s.stmt, b)
+	case *waitStmt:
+		return sleep(ctx, r.ms(s.delay))
+	case *onStmt:
+		if err := r.waitSwitch(ctx, s.id); err != nil {
+			return err
+		}
+		b.start = time.Now()
+	case *clearStmt:
+		r.panel.ClearLeds(int(r.ms(s.offMs) / time.Millisecond))
+	case *brightnessStmt:
+		adjust := s.adjust(r)
+		if !(adjust >= 0 && adjust <= 1) {
+			return &RunError{s.lineNum, fmt.Errorf("brightness adjust %g not in [0, 1]", adjust)}
+		}
+		r.panel.SetBrightnessAdjust(adjust)
+	case *letStmt:
+		r.vars[s.name] = s.val(r)
+	case *repeatStmt:
+		count := math.Inf(1)
+		if s.count != nil {
+			count = s.count(r)
+		}
+		// Each iteration takes at least a refresh of the leds, so that a
+		// body which doesn't wait doesn't spin
+		minIteration := max(r.panel.LoopDuration(), time.Millisecond)
+		for i := 0.0; i < count; i++ {
+			start := time.Now()
+			if err := r.run(ctx, s.body, &block{start: start}); err != nil {
+				return err
+			}
+			if err := sleep(ctx, time.Until(start.Add(minIteration))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *runner) led(s *ledStmt) error {
+	brightness := s.brightness(r)
+	if !(brightness >= 0 && brightness <= 1) {
+		return &RunError{s.lineNum, fmt.Errorf("brightness %g not in [0, 1]", brightness)}
+	}
+	args := make([]int, len(s.effectArgs))
+	for i, arg := range s.effectArgs {
+		args[i] = int(math.Round(arg(r)))
+	}
+	fx, _, err := pidp11.NewEffectByName(s.effect, args...)
+	if err != nil {
+		return &RunError{s.lineNum, err}
+	}
+	params := make([]float64, len(s.params))
+	for i, param := range s.params {
+		params[i] = param(r)
+		if !(params[i] >= 0 && params[i] <= 1) {
+			return &RunError{s.lineNum, fmt.Errorf("param %g not in [0, 1]", params[i])}
+		}
+	}
+	for _, id := range s.leds {
+		r.panel.Led(id, brightness, fx, params...)
+	}
+	return nil
+}
+
+func (r *runner) waitSwitch(ctx context.Context, id pidp11.SwitchID) error {
+	sub := r.panel.Subscribe(pidp11.SubscribeOptions{
+		IDs:   []pidp11.SwitchID{id},
+		Kinds: []pidp11.EventKind{pidp11.KindChange},
+	})
+	defer sub.Close()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case evt, ok := <-sub.C:
+			if !ok {
+				return fmt.Errorf("panel stopped")
+			}
+			if evt.On || evt.Delta != 0 {
+				return nil
+			}
+		}
+	}
+}
+
+func (r *runner) ms(e expr) time.Duration {
+	return time.Duration(e(r) * float64(time.Millisecond))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,122 @@
+package show
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, script := range []string{
+		"led A0 NaN",
+		"led A0 1 flash Inf",
+		"wait -inf",
+		"led A0 1 flash(nan,0) 0.5",
+		"let x = 1+Infinity",
+		"led A0..A99 1",
+		"repeat 2\nled A0 1",
+		"end",
+		"on NOPE",
+		"group RUN A0",
+		"wait 2xs",
+		"wait nans",
+		"let x = 1\nwait x+1s",
+		"wait pos",
+	} {
+		var serr *SyntaxError
+		if _, err := Parse(strings.NewReader(script)); !errors.As(err, &serr) {
+			t.Errorf("%q: got error %v, want a syntax error", script, err)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	p := &parser{vars: map[string]bool{"pos": true, "s": true}}
+	r := &runner{vars: map[string]float64{"pos": 3, "s": 4}}
+	for spec, want := range map[string]float64{
+		"250":   250,
+		"250ms": 250,
+		"1.5s":  1500,
+		"pos":   3,
+		"s":     4,
+		"pos*2": 6,
+	} {
+		e, err := p.parseDuration(spec)
+		if err != nil {
+			t.Errorf("%s: %v", spec, err)
+		} else if got := e(r); got != want {
+			t.Errorf("%s: %v ms, want %v", spec, got, want)
+		}
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, script := range []string{
+		"let x = 1e308*10\nled A0 x",
+		"let x = 1e308*10*0\nled A0 x",
+		"let x = 1e308*10*0\nled A0 1 flash x",
+		"led A0 1 simple(-1,0)",
+		"brightness 2",
+	} {
+		s, err := Parse(strings.NewReader(script))
+		if err != nil {
+			t.Fatalf("%q: %v", script, err)
+		}
+		var rerr *RunError
+		if err := s.Run(context.Background(), pidp11.NewPanel()); !errors.As(err, &rerr) || rerr.Line != strings.Count(script, "\n")+1 {
+			t.Errorf("%q: got error %v, want a run error on the last line", script, err)
+		}
+	}
+}
+
+func TestRepeatWithoutWait(t *testing.T) {
+	s, err := Parse(strings.NewReader("let n = 0\nrepeat\n    let n = n+1\n    led A0 1\nend"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &runner{panel: pidp11.NewPanel(), vars: map[string]float64{}}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.run(ctx, s.stmts, &block{start: time.Now()}); err != context.DeadlineExceeded {
+		t.Fatal(err)
+	}
+	// At least a ms per iteration
+	if n := r.vars["n"]; n < 1 || n > 50 {
+		t.Errorf("%v iterations in 50ms", n)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s, err := Parse(strings.NewReader(`
+group lamps RUN,PAUSE
+let b = 0.5
+repeat 2
+    led lamps b flash(10,10) b*2-0.5
+    led A0..A2 1
+end
+led A1 0
+wait 10ms
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	panel := pidp11.NewPanel()
+	if err := s.Run(context.Background(), panel); err != nil {
+		t.Fatal(err)
+	}
+	scene := panel.CaptureScene()
+	for id, want := range map[pidp11.LedID]float64{
+		pidp11.LED_RUN: .5, pidp11.LED_PAUSE: .5, pidp11.LED_A0: 1, pidp11.LED_A1: 0, pidp11.LED_A2: 1, pidp11.LED_A3: 0,
+	} {
+		if got := scene.Led(id).Brightness; got != want {
+			t.Errorf("%s: %v, want %v", pidp11.LedName(id), got, want)
+		}
+	}
+	if params := scene.Led(pidp11.LED_RUN).Params; len(params) != 1 || params[0] != .5 {
+		t.Errorf("RUN params %v", params)
+	}
+}
@@ -0,0 +1,189 @@
+// Package simh shows the state of a PDP-11 simulated by SimH on the panel,
+// by sampling it through the remote console of the simulator, enabled
+// with eg "set remote telnet=2323". The panel switches are mapped to
+// commands of the remote console.
+package simh
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+type Config struct {
+	Addr     string        // host:port of the remote console
+	Interval time.Duration // between the samples, 100ms if 0
+	Location string        // location whose value is shown on the data leds, eg "R0" or "1000", none if empty
+	Prompt   string        // "sim> " if empty
+	Timeout  time.Duration // for the commands, 5s if 0
+	// SimH pauses the simulation when a command is entered, so it is
+	// continued after each sample unless halted from the panel. Set this
+	// if the simulation is continued otherwise, eg with
+	// "set remote timeout".
+	NoResume bool
+}
+
+// Mirrors the simulator on the panel:
+//   - the address leds show the PC, the data leds the value of the
+//     configured location
+//   - KERNEL/SUPER/USER show the mode from the PSW
+//   - RUN is lit while the PC changes, PAUSE while it doesn't
+//   - HALT pauses the simulation, ENABLE lets it continue
+//   - CONT continues the simulation, or executes a single instruction if
+//     HALT is set, START runs from the address in the switch register.
+type Console struct {
+	cfg     Config
+	panel   *pidp11.Panel
+	fx      pidp11.Effect
+	conn    *conn
+	halted  bool
+	lastPC  uint16
+	sampled bool
+}
+
+func New(panel *pidp11.Panel, cfg Config) *Console {
+	if cfg.Interval == 0 {
+		cfg.Interval = 100 * time.Millisecond
+	}
+	if cfg.Prompt == "" {
+		cfg.Prompt = "sim> "
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	return &Console{
+		cfg:   cfg,
+		panel: panel,
+		fx:    pidp11.NewSimpleEffect(0, 0),
+	}
+}
+
+// Connects to the remote console and mirrors the simulator until the
+// context is done, the panel stops or the connection fails.
+func (c *Console) Run(ctx context.Context) error {
+	conn, err := dial(c.cfg.Addr, c.cfg.Prompt, c.cfg.Timeout)
+	if err != nil {
+		return fmt.Errorf("simh: %w", err)
+	}
+	defer conn.Close()
+	c.conn = conn
+	c.halted = c.panel.SwitchState(pidp11.SS_HALT)
+	sub := c.panel.Subscribe(pidp11.SubscribeOptions{
+		IDs: []pidp11.SwitchID{
+			pidp11.SS_HALT, pidp11.SS_CONT, pidp11.SS_START,
+		},
+		Kinds: []pidp11.EventKind{pidp11.KindChange},
+	})
+	defer sub.Close()
+	ticker := time.NewTicker(c.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case evt, ok := <-sub.C:
+			if !ok {
+				return nil
+			}
+			err = c.handle(evt)
+		case <-ticker.C:
+			err = c.sample()
+		}
+		if err != nil {
+			return fmt.Errorf("simh: %w", err)
+		}
+	}
+}
+
+func (c *Console) handle(evt pidp11.Event) error {
+	switch {
+	case evt.ID == pidp11.SS_HALT && !evt.On: // ENABLE
+		c.halted = false
+		return nil
+	case evt.ID == pidp11.SS_HALT:
+		// Any input pauses the simulation, which must not wait for the
+		// next sample if the simulation is continued otherwise.
+		c.halted = true
+		_, err := c.conn.command("")
+		return err
+	case !evt.On:
+		return nil
+	case evt.ID == pidp11.SS_CONT && c.halted:
+		_, err := c.conn.command("STEP")
+		return err
+	case evt.ID == pidp11.SS_CONT:
+		_, err := c.conn.command("CONTINUE")
+		return err
+	default: // START
+		_, err := c.conn.command(fmt.Sprintf("RUN %o", c.panel.ReadRegSwitches()))
+		c.halted = false
+		return err
+	}
+}
+
+func (c *Console) sample() error {
+	pc, err := c.examine("PC")
+	if err != nil {
+		return err
+	}
+	psw, err := c.examine("PSW")
+	if err != nil {
+		return err
+	}
+	var data uint64
+	if c.cfg.Location != "" {
+		if data, err = c.examine(c.cfg.Location); err != nil {
+			return err
+		}
+	}
+	if !c.halted && !c.cfg.NoResume {
+		if _, err := c.conn.command("CONTINUE"); err != nil {
+			return err
+		}
+	}
+	c.show(uint16(pc), uint16(psw), uint16(data))
+	return nil
+}
+
+// Matches the output of EXAMINE, eg "PC:\t001234"
+var examineRe = regexp.MustCompile(`(?m)^\s*\S+:\s+([0-7]+)`)
+
+func (c *Console) examine(location string) (uint64, error) {
+	out, err := c.conn.command("EXAMINE " + location)
+	if err != nil {
+		return 0, err
+	}
+	m := examineRe.FindStringSubmatch(out)
+	if m == nil {
+		return 0, fmt.Errorf("cannot examine %s: %q", location, out)
+	}
+	return strconv.ParseUint(m[1], 8, 32)
+}
+
+func (c *Console) show(pc, psw, data uint16) {
+	changed := !c.sampled || pc != c.lastPC
+	c.lastPC, c.sampled = pc, true
+	c.panel.ShowAddress(uint(pc), pidp11.Addr16, c.fx)
+	if c.cfg.Location != "" {
+		c.panel.ShowData(data, c.fx)
+	}
+	mode := psw >> 14
+	c.led(pidp11.LED_KERNEL, mode == 0)
+	c.led(pidp11.LED_SUPER, mode == 1)
+	c.led(pidp11.LED_USER, mode == 3)
+	c.led(pidp11.LED_RUN, changed)
+	c.led(pidp11.LED_PAUSE, !changed)
+}
+
+func (c *Console) led(id pidp11.LedID, on bool) {
+	if on {
+		c.panel.Led(id, 1, c.fx)
+	} else {
+		c.panel.Led(id, 0, c.fx)
+	}
+}
@@ -0,0 +1,214 @@
+package simh
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+// Fake remote console, answering EXAMINE from its locations and recording
+// the other commands.
+type fakeSim struct {
+	l         net.Listener
+	mu        sync.Mutex
+	locations map[string]uint16
+	commands  []string
+}
+
+func newFakeSim(t *testing.T) *fakeSim {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	sim := &fakeSim{l: l, locations: map[string]uint16{"PC": 0o1234, "PSW": 0o140000, "R0": 0o52}}
+	go sim.serve()
+	return sim
+}
+
+func (sim *fakeSim) serve() {
+	for {
+		nc, err := sim.l.Accept()
+		if err != nil {
+			return
+		}
+		go sim.serveConn(nc)
+	}
+}
+
+func (sim *fakeSim) serveConn(nc net.Conn) {
+	defer nc.Close()
+	// Telnet negotiation, to be skipped
+	nc.Write([]byte{telnetIAC, telnetWILL, 1, telnetIAC, telnetSB, 31, 0, 80, telnetIAC, telnetSE})
+	r := bufio.NewReader(nc)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		out := cmd + "\r\n" // echo
+		if loc, ok := strings.CutPrefix(cmd, "EXAMINE "); ok {
+			sim.mu.Lock()
+			out += fmt.Sprintf("%s:\t%06o\r\n", loc, sim.locations[loc])
+			sim.mu.Unlock()
+		} else {
+			sim.mu.Lock()
+			sim.commands = append(sim.commands, cmd)
+			sim.mu.Unlock()
+		}
+		if _, err := io.WriteString(nc, out+"sim> "); err != nil {
+			return
+		}
+	}
+}
+
+// Returns the commands received since the last call, other than EXAMINE.
+func (sim *fakeSim) received() []string {
+	sim.mu.Lock()
+	defer sim.mu.Unlock()
+	cmds := sim.commands
+	sim.commands = nil
+	return cmds
+}
+
+// Waits for the command, discarding the commands received before it.
+func (sim *fakeSim) await(t *testing.T, cmd string) {
+	t.Helper()
+	var cmds []string
+	eventually(t, fmt.Sprintf("%q", cmd), func() bool {
+		cmds = append(cmds, sim.received()...)
+		for i, c := range cmds {
+			if c == cmd {
+				cmds = cmds[i+1:]
+				return true
+			}
+		}
+		return false
+	})
+	sim.mu.Lock()
+	sim.commands = append(cmds, sim.commands...)
+	sim.mu.Unlock()
+}
+
+// Starts a panel on the in-memory backend, and the console on it.
+func startConsole(t *testing.T, cfg Config) (*pidp11.Panel, *pidp11.MemBackend) {
+	t.Helper()
+	mem := pidp11.NewMemBackend()
+	panel := pidp11.NewPanel(
+		pidp11.WithBackend(mem),
+		pidp11.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))),
+	)
+	if err := panel.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { panel.Stop() })
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- New(panel, cfg).Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != context.Canceled {
+			t.Errorf("run: %v", err)
+		}
+	})
+	return panel, mem
+}
+
+// Fails unless the condition becomes true within a second.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// Actions the switch, waiting for the panel to read it.
+func setSwitch(t *testing.T, panel *pidp11.Panel, mem *pidp11.MemBackend, id pidp11.SwitchID, on bool) {
+	t.Helper()
+	mem.SetSwitchByID(id, on)
+	eventually(t, pidp11.SwitchName(id), func() bool { return panel.SwitchState(id) == on })
+}
+
+func press(t *testing.T, panel *pidp11.Panel, mem *pidp11.MemBackend, id pidp11.SwitchID) {
+	t.Helper()
+	setSwitch(t, panel, mem, id, true)
+	setSwitch(t, panel, mem, id, false)
+}
+
+func TestMirror(t *testing.T) {
+	sim := newFakeSim(t)
+	panel, _ := startConsole(t, Config{Addr: sim.l.Addr().String(), Interval: 10 * time.Millisecond, Location: "R0"})
+	eventually(t, "PC shown", func() bool {
+		return panel.Brightness(pidp11.LED_A2) == 1 && panel.Brightness(pidp11.LED_D1) == 1
+	})
+	for bit := range 16 {
+		id := pidp11.LED_A0 + pidp11.LedID(bit)
+		if want := float64(uint16(0o1234) >> bit & 1); panel.Brightness(id) != want {
+			t.Errorf("A%d: %v, want %v", bit, panel.Brightness(id), want)
+		}
+		id = pidp11.LED_D0 + pidp11.LedID(bit)
+		if want := float64(uint16(0o52) >> bit & 1); panel.Brightness(id) != want {
+			t.Errorf("D%d: %v, want %v", bit, panel.Brightness(id), want)
+		}
+	}
+	if panel.Brightness(pidp11.LED_USER) != 1 || panel.Brightness(pidp11.LED_KERNEL) != 0 {
+		t.Error("USER mode not shown")
+	}
+	eventually(t, "PAUSE lit", func() bool { return panel.Brightness(pidp11.LED_PAUSE) == 1 })
+	sim.mu.Lock()
+	sim.locations["PC"] = 0o1240
+	sim.mu.Unlock()
+	eventually(t, "RUN lit", func() bool { return panel.Brightness(pidp11.LED_RUN) == 1 })
+
+	// Each sample continues the simulation
+	if cmds := sim.received(); len(cmds) == 0 || cmds[len(cmds)-1] != "CONTINUE" {
+		t.Errorf("commands %q, want CONTINUE", cmds)
+	}
+}
+
+func TestSwitches(t *testing.T) {
+	for _, noResume := range []bool{false, true} {
+		t.Run(fmt.Sprint("NoResume=", noResume), func(t *testing.T) {
+			sim := newFakeSim(t)
+			panel, mem := startConsole(t, Config{Addr: sim.l.Addr().String(), Interval: 10 * time.Millisecond, NoResume: noResume})
+			time.Sleep(50 * time.Millisecond)
+
+			// HALT pauses immediately, and stops continuing
+			sim.received()
+			setSwitch(t, panel, mem, pidp11.SS_HALT, true)
+			sim.await(t, "")
+			sim.received()
+			time.Sleep(50 * time.Millisecond)
+			if cmds := sim.received(); len(cmds) > 0 {
+				t.Errorf("commands %q while halted", cmds)
+			}
+
+			press(t, panel, mem, pidp11.SS_CONT)
+			sim.await(t, "STEP")
+
+			// ENABLE lets the simulation continue
+			setSwitch(t, panel, mem, pidp11.SS_HALT, false)
+			press(t, panel, mem, pidp11.SS_CONT)
+			sim.await(t, "CONTINUE")
+
+			setSwitch(t, panel, mem, pidp11.SS_SR0+9, true)
+			press(t, panel, mem, pidp11.SS_START)
+			sim.await(t, "RUN 1000")
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package simh
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// Telnet commands, only skipped
+const (
+	telnetIAC  = 255
+	telnetSB   = 250
+	telnetSE   = 240
+	telnetWILL = 251
+	telnetDONT = 254
+)
+
+// Connection to the remote console, which is a telnet session.
+type conn struct {
+	nc      net.Conn
+	r       *bufio.Reader
+	prompt  string
+	timeout time.Duration
+}
+
+func dial(addr, prompt string, timeout time.Duration) (*conn, error) {
+	nc, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{nc: nc, r: bufio.NewReader(nc), prompt: prompt, timeout: timeout}
+	// Wake up the console and wait for its prompt
+	if _, err := c.command(""); err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *conn) Close() error {
+	return c.nc.Close()
+}
+
+// Sends the command and returns its output, up to the next prompt.
+func (c *conn) command(cmd string) (string, error) {
+	c.nc.SetDeadline(time.Now().Add(c.timeout))
+	if _, err := fmt.Fprintf(c.nc, "%s\r\n", cmd); err != nil {
+		return "", err
+	}
+	var out []byte
+	for !bytes.HasSuffix(out, []byte(c.prompt)) {
+		b, err := c.readByte()
+		if err != nil {
+			return "", err
+		}
+		out = append(out, b)
+	}
+	out = out[:len(out)-len(c.prompt)]
+	// Remove the echo of the command
+	text := strings.ReplaceAll(string(out), "\r", "")
+	if cmd != "" {
+		if _, after, ok := strings.Cut(text, cmd+"\n"); ok {
+			text = after
+		}
+	}
+	return text, nil
+}
+
+// Reads a byte of data, skipping the telnet commands.
+func (c *conn) readByte() (byte, error) {
+	for {
+		b, err := c.r.ReadByte()
+		if err != nil || b != telnetIAC {
+			return b, err
+		}
+		cmd, err := c.r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case cmd == telnetIAC:
+			return cmd, nil
+		case cmd >= telnetWILL && cmd <= telnetDONT:
+			if _, err := c.r.ReadByte(); err != nil {
+				return 0, err
+			}
+		case cmd == telnetSB:
+			// Skip to IAC SE
+			for prev := byte(0); ; {
+				b, err := c.r.ReadByte()
+				if err != nil {
+					return 0, err
+				}
+				if prev == telnetIAC && b == telnetSE {
+					break
+				}
+				prev = b
+			}
+		}
+	}
+}
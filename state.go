@@ -0,0 +1,79 @@
+package pidp11
+
+// State of all switches at a point in time.
+type Snapshot struct {
+	Register uint       // value of the register switches, see ReadRegSwitches()
+	Test     bool       // TEST switch on
+	Halt     bool       // ENABLE/HALT switch in HALT position
+	BusCycle bool       // S_INST/S_BUS_CYCLE switch in S_BUS_CYCLE position
+	Held     []SwitchID // momentary switches currently held
+	KnobA    int        // steps accumulated by the address knob, positive clockwise
+	KnobD    int        // steps accumulated by the data knob
+}
+
+// Returns the integer indicated by the register switches.
+func (p *Panel) ReadRegSwitches() uint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.regSwitches()
+}
+
+func (p *Panel) regSwitches() uint {
+	val := uint(0)
+	for i := range 22 {
+		if p.switches[swSR0+nativeSwitchID(i)] {
+			val ^= 1 << i
+		}
+	}
+	return val
+}
+
+// Returns true if the switch is on: up for the register switches, held
+// for the momentary switches, and for the toggles in the position given
+// by the ID, eg SwitchState(SS_HALT) is true if ENABLE/HALT is on HALT.
+// Always false for the knobs rotation, see Snapshot().
+// The initial state of the switches is read before Start() returns.
+func (p *Panel) SwitchState(id SwitchID) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.switchState(id)
+}
+
+// Must be called with the panel mutex held.
+func (p *Panel) switchState(id SwitchID) bool {
+	switch {
+	case id >= SS_SR0 && id <= SS_SR21:
+		return p.switches[swSR0+nativeSwitchID(id-SS_SR0)]
+	case id == SS_TEST:
+		return p.switches[swTEST]
+	case id == SS_HALT || id == SS_ENABLE:
+		return p.switches[swENABLE] == (id == SS_HALT)
+	case id == SS_S_BUS_CYCLE || id == SS_S_INST:
+		return p.switches[swSINST] == (id == SS_S_BUS_CYCLE)
+	}
+	if nid, ok := momentaryNativeIDs[id]; ok {
+		return p.switches[nid]
+	}
+	return false
+}
+
+// Returns the state of all switches.
+// The initial state of the switches is read before Start() returns.
+func (p *Panel) Snapshot() Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	snap := Snapshot{
+		Register: p.regSwitches(),
+		Test:     p.switches[swTEST],
+		Halt:     p.switches[swENABLE],
+		BusCycle: p.switches[swSINST],
+		KnobA:    p.knobs[0].position,
+		KnobD:    p.knobs[1].position,
+	}
+	for id := SS_KNOBA_PUSH; id <= SS_START; id++ {
+		if nid, ok := momentaryNativeIDs[id]; ok && p.switches[nid] {
+			snap.Held = append(snap.Held, id)
+		}
+	}
+	return snap
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+const (
+	ledsInterval      = 50 * time.Millisecond
+	keepaliveInterval = 15 * time.Second
+)
+
+// Streams the panel events as "switch" events, and the changes of
+// brightness as "leds" events, the first one giving all the leds.
+func (s *server) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		httpError(w, http.StatusInternalServerError, "streaming unsupported")
+		return
+	}
+	sub := s.panel.Subscribe(pidp11.SubscribeOptions{Policy: pidp11.CoalesceKnobs})
+	defer sub.Close()
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	send := func(event string, v any) bool {
+		data, _ := json.Marshal(v)
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	shown := s.ledLevels()
+	if !send("leds", shown) {
+		return
+	}
+	ledsTicker := time.NewTicker(ledsInterval)
+	defer ledsTicker.Stop()
+	keepalive := time.NewTicker(keepaliveInterval)
+	defer keepalive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case evt, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			if !send("switch", evt) {
+				return
+			}
+		case <-ledsTicker.C:
+			changed := map[string]float64{}
+			for name, level := range s.ledLevels() {
+				if shown[name] != level {
+					changed[name] = level
+					shown[name] = level
+				}
+			}
+			if len(changed) > 0 && !send("leds", changed) {
+				return
+			}
+		case <-keepalive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
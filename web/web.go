@@ -0,0 +1,255 @@
+// Package web serves an HTTP API controlling the panel, with a stream of
+// its events and led changes, and a page showing the panel in a browser.
+//
+// The API, with JSON bodies:
+//
+//	GET  /api/leds                the brightness of all leds, by name
+//	POST /api/leds/{name}         {"brightness": 1, "effect": "flash", "args": [0, 0], "params": [0.5]}
+//	POST /api/clear               {"offMs": 500}
+//	GET  /api/brightness          {"adjust": 1}
+//	PUT  /api/brightness          {"adjust": 0.5}
+//	GET  /api/switches            the state of the switches
+//	POST /api/switches/{name}     {"on": true}
+//	POST /api/knobs/{name}        {"cw": true}
+//	GET  /api/events              server-sent events "switch" and "leds"
+//
+// The effects are given by name, see pidp11.NewEffectByName(), "simple"
+// by default. Actioning the switches requires Config.Switches.
+package web
+
+import (
+	"crypto/subtle"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/perpen/pidp11"
+)
+
+// Actions the switches, as done by pidp11.MemBackend.
+type Switches interface {
+	SetSwitchByID(id pidp11.SwitchID, on bool)
+	TurnKnob(id pidp11.SwitchID, cw bool, interval time.Duration)
+}
+
+type Config struct {
+	Token    string   // if not empty, required as bearer token, or as query parameter "token"
+	Switches Switches // the switches can't be actioned if nil
+}
+
+type server struct {
+	panel *pidp11.Panel
+	cfg   Config
+}
+
+//go:embed index.html
+var indexHTML []byte
+
+// Returns the handler of the page and the API.
+func NewHandler(panel *pidp11.Panel, cfg Config) http.Handler {
+	s := &server{panel: panel, cfg: cfg}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", s.index)
+	mux.HandleFunc("GET /api/leds", s.auth(s.getLeds))
+	mux.HandleFunc("POST /api/leds/{name}", s.auth(s.setLed))
+	mux.HandleFunc("POST /api/clear", s.auth(s.clear))
+	mux.HandleFunc("GET /api/brightness", s.auth(s.getBrightness))
+	mux.HandleFunc("PUT /api/brightness", s.auth(s.setBrightness))
+	mux.HandleFunc("GET /api/switches", s.auth(s.getSwitches))
+	mux.HandleFunc("POST /api/switches/{name}", s.auth(s.setSwitch))
+	mux.HandleFunc("POST /api/knobs/{name}", s.auth(s.turnKnob))
+	mux.HandleFunc("GET /api/events", s.auth(s.events))
+	return mux
+}
+
+// The page gets the token from its own URL.
+func (s *server) index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func (s *server) auth(h http.HandlerFunc) http.HandlerFunc {
+	if s.cfg.Token == "" {
+		return h
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			token = r.URL.Query().Get("token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			httpError(w, http.StatusUnauthorized, "invalid token")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func httpError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		httpError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+func (s *server) ledLevels() map[string]float64 {
+	levels := map[string]float64{}
+	for id, name := range pidp11.LedNames() {
+		levels[name] = s.panel.Brightness(pidp11.LedID(id))
+	}
+	return levels
+}
+
+func (s *server) getLeds(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.ledLevels())
+}
+
+type ledRequest struct {
+	Brightness float64   `json:"brightness"`
+	Effect     string    `json:"effect"`
+	Args       []int     `json:"args"`
+	Params     []float64 `json:"params"`
+}
+
+func (s *server) setLed(w http.ResponseWriter, r *http.Request) {
+	id, ok := pidp11.LookupLed(r.PathValue("name"))
+	if !ok {
+		httpError(w, http.StatusNotFound, "unknown led")
+		return
+	}
+	req := ledRequest{Effect: "simple"}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if !(req.Brightness >= 0 && req.Brightness <= 1) {
+		httpError(w, http.StatusBadRequest, "brightness must be in [0, 1]")
+		return
+	}
+	fx, params, err := pidp11.NewEffectByName(req.Effect, req.Args...)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(req.Params) != params {
+		httpError(w, http.StatusBadRequest, "wrong number of params for the effect")
+		return
+	}
+	if err := pidp11.CheckParams(req.Params...); err != nil {
+		httpError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	s.panel.Led(id, req.Brightness, fx, req.Params...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) clear(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		OffMs int `json:"offMs"`
+	}
+	if r.ContentLength != 0 && !readJSON(w, r, &req) {
+		return
+	}
+	s.panel.ClearLeds(req.OffMs)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type brightnessBody struct {
+	Adjust float64 `json:"adjust"`
+}
+
+func (s *server) getBrightness(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, brightnessBody{Adjust: s.panel.GetBrightnessAdjust()})
+}
+
+func (s *server) setBrightness(w http.ResponseWriter, r *http.Request) {
+	var req brightnessBody
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if !(req.Adjust >= 0 && req.Adjust <= 1) {
+		httpError(w, http.StatusBadRequest, "adjust must be in [0, 1]")
+		return
+	}
+	s.panel.SetBrightnessAdjust(req.Adjust)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type switchesBody struct {
+	States   map[string]bool `json:"states"`
+	Register uint            `json:"register"`
+	KnobA    int             `json:"knobA"`
+	KnobD    int             `json:"knobD"`
+}
+
+func (s *server) getSwitches(w http.ResponseWriter, r *http.Request) {
+	snap := s.panel.Snapshot()
+	body := switchesBody{
+		States:   map[string]bool{},
+		Register: snap.Register,
+		KnobA:    snap.KnobA,
+		KnobD:    snap.KnobD,
+	}
+	for id := pidp11.SS_KNOBA_PUSH; id <= pidp11.SS_SR21; id++ {
+		if id != pidp11.SS_KNOBA && id != pidp11.SS_KNOBD {
+			body.States[pidp11.SwitchName(id)] = s.panel.SwitchState(id)
+		}
+	}
+	writeJSON(w, body)
+}
+
+func (s *server) setSwitch(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Switches == nil {
+		httpError(w, http.StatusForbidden, "the switches can't be actioned")
+		return
+	}
+	id, ok := pidp11.LookupSwitch(r.PathValue("name"))
+	// The toggles are given by their event IDs, see MemBackend.SetSwitchByID()
+	if !ok || id == pidp11.SS_KNOBA || id == pidp11.SS_KNOBD || id == pidp11.SS_REGISTER ||
+		id == pidp11.SS_ENABLE || id == pidp11.SS_S_INST {
+		httpError(w, http.StatusNotFound, "unknown switch")
+		return
+	}
+	var req struct {
+		On bool `json:"on"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	s.cfg.Switches.SetSwitchByID(id, req.On)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *server) turnKnob(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.Switches == nil {
+		httpError(w, http.StatusForbidden, "the switches can't be actioned")
+		return
+	}
+	id, ok := pidp11.LookupSwitch(r.PathValue("name"))
+	if !ok || id != pidp11.SS_KNOBA && id != pidp11.SS_KNOBD {
+		httpError(w, http.StatusNotFound, "unknown knob")
+		return
+	}
+	var req struct {
+		CW bool `json:"cw"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	s.cfg.Switches.TurnKnob(id, req.CW, 10*time.Millisecond)
+	w.WriteHeader(http.StatusNoContent)
+}
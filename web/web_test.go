@@ -0,0 +1,89 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/perpen/pidp11"
+)
+
+func TestSetLed(t *testing.T) {
+	panel := pidp11.NewPanel()
+	h := NewHandler(panel, Config{})
+	for _, tc := range []struct {
+		body   string
+		status int
+	}{
+		{`{"brightness": 1}`, http.StatusNoContent},
+		{`{"brightness": 0.5, "effect": "flash", "args": [100, 100], "params": [0.5]}`, http.StatusNoContent},
+		{`{"brightness": 1.5}`, http.StatusBadRequest},
+		{`{"brightness": -1}`, http.StatusBadRequest},
+		{`{"brightness": 1, "effect": "flash", "params": [1.5]}`, http.StatusBadRequest},
+		{`{"brightness": 1, "effect": "strobe", "params": [-0.1]}`, http.StatusBadRequest},
+		{`{"brightness": 1, "effect": "flash"}`, http.StatusBadRequest},
+		{`{"brightness": 1, "effect": "simple", "args": [-1, 0]}`, http.StatusBadRequest},
+		{`{"brightness": 1, "effect": "sparkle"}`, http.StatusBadRequest},
+		{`{"brightness": NaN}`, http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/api/leds/RUN", strings.NewReader(tc.body)))
+		if w.Code != tc.status {
+			t.Errorf("%s: status %d, want %d: %s", tc.body, w.Code, tc.status, w.Body)
+		}
+	}
+	if state := panel.CaptureScene().Led(pidp11.LED_RUN); state.Brightness != 0.5 || len(state.Params) != 1 {
+		t.Errorf("RUN state %+v", state)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/api/leds/NOPE", strings.NewReader(`{}`)))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown led: status %d", w.Code)
+	}
+}
+
+func TestCheckParams(t *testing.T) {
+	for _, params := range [][]float64{{0}, {1, .5}, nil} {
+		if err := pidp11.CheckParams(params...); err != nil {
+			t.Errorf("%v: %v", params, err)
+		}
+	}
+	nan := 0.0
+	nan /= nan
+	for _, params := range [][]float64{{nan}, {1.01}, {.5, -1}} {
+		if err := pidp11.CheckParams(params...); err == nil {
+			t.Errorf("%v: no error", params)
+		}
+	}
+}
+
+func TestAuth(t *testing.T) {
+	h := NewHandler(pidp11.NewPanel(), Config{Token: "secret"})
+	for token, status := range map[string]int{"": http.StatusUnauthorized, "wrong": http.StatusUnauthorized, "secret": http.StatusOK} {
+		r := httptest.NewRequest("GET", "/api/brightness", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != status {
+			t.Errorf("token %q: status %d, want %d", token, w.Code, status)
+		}
+	}
+}
+
+func TestSetSwitch(t *testing.T) {
+	h := NewHandler(pidp11.NewPanel(), Config{Switches: pidp11.NewMemBackend()})
+	for name, status := range map[string]int{
+		"HALT": http.StatusNoContent, "S_BUS_CYCLE": http.StatusNoContent, "SR3": http.StatusNoContent,
+		"ENABLE": http.StatusNotFound, "S_INST": http.StatusNotFound, "KNOBA": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/api/switches/"+name, strings.NewReader(`{"on": false}`)))
+		if w.Code != status {
+			t.Errorf("%s: status %d, want %d", name, w.Code, status)
+		}
+	}
+}